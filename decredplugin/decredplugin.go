@@ -248,6 +248,10 @@ type Comment struct {
 	TotalVotes  uint64 `json:"totalvotes"`  // Total number of up/down votes
 	ResultVotes int64  `json:"resultvotes"` // Vote score
 	Censored    bool   `json:"censored"`    // Has this comment been censored
+
+	// Set when the comment was censored
+	CensoredReason string `json:"censoredreason,omitempty"` // Reason comment was censored
+	CensoredBy     string `json:"censoredby,omitempty"`     // Pubkey of the admin that censored the comment
 }
 
 // EncodeComment encodes Comment into a JSON byte slice.
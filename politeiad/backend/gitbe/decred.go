@@ -1254,6 +1254,8 @@ func (g *gitBackEnd) pluginCensorComment(payload string) (string, error) {
 	oc := c
 	c.Comment = ""
 	c.Censored = true
+	c.CensoredReason = censor.Reason
+	c.CensoredBy = censor.PublicKey
 	decredPluginCommentsCache[censor.Token][censor.CommentID] = c
 
 	g.Unlock()
@@ -1445,6 +1447,8 @@ func (g *gitBackEnd) replayComments(token string) (map[string]decredplugin.Comme
 				// Delete comment
 				c.Comment = ""
 				c.Censored = true
+				c.CensoredReason = cc.Reason
+				c.CensoredBy = cc.PublicKey
 				comments[cc.CommentID] = c
 
 			case journalActionAddLike:
@@ -102,7 +102,7 @@ func (b *backend) ProcessEditUser(eu *v1.EditUser, adminUser *database.User) (*v
 		user.NewUserPaywallTxNotBefore = 0
 		user.NewUserPaywallPollExpiry = 0
 	case v1.UserEditUnlock:
-		user.FailedLoginAttempts = 0
+		database.ResetFailedLogins(user)
 	default:
 		return nil, fmt.Errorf("unsupported user edit action: %v",
 			v1.UserEditAction[eu.Action])
@@ -149,6 +149,7 @@ const (
 	ErrorStatusChangeMessageCannotBeBlank  ErrorStatusT = 45
 	ErrorStatusCensorReasonCannotBeBlank   ErrorStatusT = 46
 	ErrorStatusCannotCensorComment         ErrorStatusT = 47
+	ErrorStatusUserDeactivated             ErrorStatusT = 48
 
 	// Proposal status codes (set and get)
 	PropStatusInvalid           PropStatusT = 0 // Invalid status
@@ -244,6 +245,7 @@ var (
 		ErrorStatusChangeMessageCannotBeBlank:  "status change message cannot be blank",
 		ErrorStatusCensorReasonCannotBeBlank:   "censor comment reason cannot be blank",
 		ErrorStatusCannotCensorComment:         "cannot censor comment",
+		ErrorStatusUserDeactivated:             "user account is deactivated",
 	}
 
 	// PropStatus converts propsal status codes to human readable text
@@ -764,6 +766,10 @@ type Comment struct {
 	ResultVotes int64  `json:"resultvotes"` // Vote score
 	Censored    bool   `json:"censored"`    // Has this comment been censored
 
+	// Set when the comment was censored
+	CensoredReason string `json:"censoredreason,omitempty"` // Reason comment was censored
+	CensoredBy     string `json:"censoredby,omitempty"`     // Pubkey of the admin that censored the comment
+
 	// Metadata generated by www
 	UserID string `json:"userid"` // User id
 }
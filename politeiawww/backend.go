@@ -19,7 +19,6 @@ import (
 
 	"golang.org/x/crypto/bcrypt"
 
-	"github.com/dajohi/goemail"
 	"github.com/decred/dcrd/chaincfg"
 	"github.com/decred/dcrtime/merkle"
 	"github.com/decred/politeia/decredplugin"
@@ -29,7 +28,9 @@ import (
 	www "github.com/decred/politeia/politeiawww/api/v1"
 	"github.com/decred/politeia/politeiawww/database"
 	"github.com/decred/politeia/politeiawww/database/localdb"
+	"github.com/decred/politeia/politeiawww/paywall"
 	"github.com/decred/politeia/util"
+	"github.com/robfig/cron"
 )
 
 const (
@@ -76,6 +77,10 @@ type backend struct {
 	client          *http.Client                 // politeiad client
 	userPubkeys     map[string]string            // [pubkey][userid]
 	userPaywallPool map[uint64]paywallPoolMember // [userid][paywallPoolMember]
+	cron            *cron.Cron                   // Scheduler for periodic tasks
+
+	// paymentProcessor looks up payments to the paywalls in the pool.
+	paymentProcessor paywall.PaymentProcessor
 
 	// These properties are only used for testing.
 	test                   bool
@@ -223,9 +228,15 @@ func (b *backend) generateVerificationTokenAndExpiry() ([]byte, int64, error) {
 	return token, expiry, nil
 }
 
+// lockoutPolicy locks users after LoginAttemptsToLockUser failed logins in a
+// row until they reset their password or an admin unlocks them.
+var lockoutPolicy = database.LockoutPolicy{
+	MaxFailedLogins: LoginAttemptsToLockUser,
+}
+
 // checkUserIsLocked checks if a user is locked after many login attempts
-func checkUserIsLocked(failedLoginAttempts uint64) bool {
-	return failedLoginAttempts >= LoginAttemptsToLockUser
+func checkUserIsLocked(user *database.User) bool {
+	return lockoutPolicy.IsLocked(user, time.Now())
 }
 
 // hashPassword hashes the given password string with the default bcrypt cost
@@ -287,8 +298,8 @@ func (b *backend) login(l *www.Login) loginReplyWithError {
 	err = bcrypt.CompareHashAndPassword(user.HashedPassword,
 		[]byte(l.Password))
 	if err != nil {
-		if !checkUserIsLocked(user.FailedLoginAttempts) {
-			user.FailedLoginAttempts++
+		if !checkUserIsLocked(user) {
+			locked := lockoutPolicy.RecordFailedLogin(user, time.Now())
 			err := b.db.UserUpdate(*user)
 			if err != nil {
 				return loginReplyWithError{
@@ -297,8 +308,8 @@ func (b *backend) login(l *www.Login) loginReplyWithError {
 				}
 			}
 
-			// Check if the user is locked again so we can send an email.
-			if checkUserIsLocked(user.FailedLoginAttempts) && !b.test {
+			// Send an email if the user was just locked.
+			if locked && !b.test {
 				// This is conditional on the email server being setup.
 				err := b.emailUserLocked(user.Email)
 				if err != nil {
@@ -319,7 +330,7 @@ func (b *backend) login(l *www.Login) loginReplyWithError {
 	}
 
 	// Check if user is locked due to too many login attempts
-	if checkUserIsLocked(user.FailedLoginAttempts) {
+	if checkUserIsLocked(user) {
 		return loginReplyWithError{
 			reply: nil,
 			err: www.UserError{
@@ -328,8 +339,18 @@ func (b *backend) login(l *www.Login) loginReplyWithError {
 		}
 	}
 
+	// Check if the account has been deactivated by an admin
+	if user.Deactivated {
+		return loginReplyWithError{
+			reply: nil,
+			err: www.UserError{
+				ErrorCode: www.ErrorStatusUserDeactivated,
+			},
+		}
+	}
+
 	lastLoginTime := user.LastLoginTime
-	user.FailedLoginAttempts = 0
+	database.ResetFailedLogins(user)
 	user.LastLoginTime = time.Now().Unix()
 	err = b.db.UserUpdate(*user)
 	if err != nil {
@@ -410,15 +431,10 @@ func (b *backend) emailNewUserVerificationLink(email, token string) error {
 	if err != nil {
 		return err
 	}
-	from := "noreply@decred.org"
 	subject := "Verify Your Email"
 	body := buf.String()
 
-	msg := goemail.NewHTMLMessage(from, subject, body)
-	msg.AddTo(email)
-
-	msg.SetName(politeiaMailName)
-	return b.cfg.SMTP.Send(msg)
+	return b.enqueueEmail(subject, body, []string{email}, nil)
 }
 
 // emailResetPasswordVerificationLink emails the link with the reset password
@@ -446,15 +462,10 @@ func (b *backend) emailResetPasswordVerificationLink(email, token string) error
 	if err != nil {
 		return err
 	}
-	from := "noreply@decred.org"
 	subject := "Reset Your Password"
 	body := buf.String()
 
-	msg := goemail.NewHTMLMessage(from, subject, body)
-	msg.AddTo(email)
-
-	msg.SetName(politeiaMailName)
-	return b.cfg.SMTP.Send(msg)
+	return b.enqueueEmail(subject, body, []string{email}, nil)
 }
 
 // emailUpdateUserKeyVerificationLink emails the link with the verification token
@@ -482,15 +493,10 @@ func (b *backend) emailUpdateUserKeyVerificationLink(email, publicKey, token str
 	if err != nil {
 		return err
 	}
-	from := "noreply@decred.org"
 	subject := "Verify Your New Identity"
 	body := buf.String()
 
-	msg := goemail.NewHTMLMessage(from, subject, body)
-	msg.AddTo(email)
-
-	msg.SetName(politeiaMailName)
-	return b.cfg.SMTP.Send(msg)
+	return b.enqueueEmail(subject, body, []string{email}, nil)
 }
 
 // emailUserLocked notifies the user its account has been locked and
@@ -518,15 +524,10 @@ func (b *backend) emailUserLocked(email string) error {
 	if err != nil {
 		return err
 	}
-	from := "noreply@decred.org"
 	subject := "Locked Account - Reset Your Password"
 	body := buf.String()
 
-	msg := goemail.NewHTMLMessage(from, subject, body)
-	msg.AddTo(email)
-
-	msg.SetName(politeiaMailName)
-	return b.cfg.SMTP.Send(msg)
+	return b.enqueueEmail(subject, body, []string{email}, nil)
 }
 
 // makeRequest makes an http request to the method and route provided, serializing
@@ -930,7 +931,7 @@ func (b *backend) verifyResetPassword(user *database.User, rp www.ResetPassword,
 	user.ResetPasswordVerificationToken = nil
 	user.ResetPasswordVerificationExpiry = 0
 	user.HashedPassword = hashedPassword
-	user.FailedLoginAttempts = 0
+	database.ResetFailedLogins(user)
 
 	return b.db.UserUpdate(*user)
 }
@@ -2318,6 +2319,8 @@ func (b *backend) ProcessCensorComment(cc www.CensorComment, user *database.User
 	if c, ok := b.inventory[cc.Token].comments[cc.CommentID]; ok {
 		c.Comment = ""
 		c.Censored = true
+		c.CensoredReason = cc.Reason
+		c.CensoredBy = cc.PublicKey
 		b.inventory[cc.Token].comments[cc.CommentID] = c
 	} else {
 		return nil, fmt.Errorf("comment not found %v: %v", cc.Token, cc.CommentID)
@@ -3012,7 +3015,6 @@ func (b *backend) getVoteResultsFromPlugin(token string) (*decredplugin.VoteResu
 // NewBackend creates a new backend context for use in www and tests.
 func NewBackend(cfg *config) (*backend, error) {
 	// Setup database.
-	//localdb.UseLogger(localdbLog)
 	db, err := localdb.New(cfg.DataDir)
 	if err != nil {
 		return nil, err
@@ -3024,6 +3026,8 @@ func NewBackend(cfg *config) (*backend, error) {
 		cfg:             cfg,
 		userPubkeys:     make(map[string]string),
 		userPaywallPool: make(map[uint64]paywallPoolMember),
+
+		paymentProcessor: &paywall.Dcrdata{},
 	}
 
 	// Setup pubkey-userid map
@@ -3038,6 +3042,19 @@ func NewBackend(cfg *config) (*backend, error) {
 		return nil, err
 	}
 
+	// Start delivering queued emails.
+	b.initEmailQueue()
+
+	// Schedule the admin digest.
+	if cfg.AdminDigest {
+		b.cron = cron.New()
+		err = b.cron.AddFunc(adminDigestSchedule, b.adminDigestCronJob)
+		if err != nil {
+			return nil, err
+		}
+		b.cron.Start()
+	}
+
 	return b, nil
 }
 
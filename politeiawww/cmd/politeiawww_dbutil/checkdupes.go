@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/decred/politeia/politeiawww/database"
+	"github.com/decred/politeia/politeiawww/database/localdb"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// dupeReport collects the results of --checkdupes.  The duplicate maps are
+// keyed by the shared value and hold the emails of the users that share it.
+type dupeReport struct {
+	Usernames map[string][]string `json:"usernames"` // Case insensitive
+	IDs       map[uint64][]string `json:"ids"`
+	Paywalls  map[string][]string `json:"paywalls"` // Registration paywall addresses
+	Orphans   []string            `json:"orphans"`  // Keys of records without a user
+}
+
+// addUser records the user under every value that must be unique.
+func (r *dupeReport) addUser(u *database.User) {
+	username := strings.ToLower(u.Username)
+	r.Usernames[username] = append(r.Usernames[username], u.Email)
+	r.IDs[u.ID] = append(r.IDs[u.ID], u.Email)
+	if u.NewUserPaywallAddress != "" {
+		r.Paywalls[u.NewUserPaywallAddress] = append(
+			r.Paywalls[u.NewUserPaywallAddress], u.Email)
+	}
+}
+
+// prune removes the values that are only used by a single user.
+func (r *dupeReport) prune() {
+	for k, v := range r.Usernames {
+		if len(v) < 2 {
+			delete(r.Usernames, k)
+		}
+	}
+	for k, v := range r.IDs {
+		if len(v) < 2 {
+			delete(r.IDs, k)
+		}
+	}
+	for k, v := range r.Paywalls {
+		if len(v) < 2 {
+			delete(r.Paywalls, k)
+		}
+	}
+}
+
+// found returns the number of problems in the report.
+func (r *dupeReport) found() int {
+	return len(r.Usernames) + len(r.IDs) + len(r.Paywalls) + len(r.Orphans)
+}
+
+// print writes the report to stdout.
+func (r *dupeReport) print() {
+	printDupes := func(what string, dupes map[string][]string) {
+		keys := make([]string, 0, len(dupes))
+		for k := range dupes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Printf("Duplicate %v %v: %v\n", what, k,
+				strings.Join(dupes[k], ", "))
+		}
+	}
+
+	ids := make(map[string][]string, len(r.IDs))
+	for id, emails := range r.IDs {
+		ids[fmt.Sprint(id)] = emails
+	}
+
+	printDupes("username", r.Usernames)
+	printDupes("id", ids)
+	printDupes("paywall address", r.Paywalls)
+	for _, key := range r.Orphans {
+		fmt.Printf("Orphaned record %v\n", key)
+	}
+	fmt.Printf("%v problems found\n", r.found())
+}
+
+// historyEmail returns the email of the user that a history key belongs to.
+// History keys are "<prefix><email>:<16 hex digit version>".
+func historyEmail(key string) string {
+	email := strings.TrimPrefix(key, localdb.UserHistoryPrefix)
+	if len(email) < 17 {
+		return ""
+	}
+	return email[:len(email)-17]
+}
+
+// findOrphans returns the keys of the checksum, history, session and
+// preferences records whose user doesn't exist.  Session and preferences
+// records are skipped if ids is nil.
+func findOrphans(userdb *leveldb.DB, emails map[string]struct{}, ids map[uint64]struct{}) ([]string, error) {
+	var orphans []string
+	iter := userdb.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		key := string(iter.Key())
+
+		var exists bool
+		switch {
+		case strings.HasPrefix(key, localdb.UserChecksumPrefix):
+			_, exists = emails[strings.TrimPrefix(key,
+				localdb.UserChecksumPrefix)]
+		case strings.HasPrefix(key, localdb.UserHistoryPrefix):
+			_, exists = emails[historyEmail(key)]
+		case ids == nil:
+			continue
+		case strings.HasPrefix(key, localdb.SessionPrefix):
+			s, err := localdb.DecodeSession(iter.Value())
+			if err != nil {
+				// Reported by --fsck.
+				continue
+			}
+			_, exists = ids[s.UserID]
+		case strings.HasPrefix(key, localdb.PreferencesPrefix):
+			p, err := localdb.DecodeUserPreferences(iter.Value())
+			if err != nil {
+				// Reported by --fsck.
+				continue
+			}
+			_, exists = ids[p.UserID]
+		default:
+			continue
+		}
+		if !exists {
+			orphans = append(orphans, key)
+		}
+	}
+
+	return orphans, iter.Error()
+}
+
+// checkDupes scans the raw database for duplicates and orphaned records.
+func checkDupes() (*dupeReport, error) {
+	userdb, err := openRawDB()
+	if err != nil {
+		return nil, err
+	}
+	defer userdb.Close()
+
+	r := dupeReport{
+		Usernames: make(map[string][]string),
+		IDs:       make(map[uint64][]string),
+		Paywalls:  make(map[string][]string),
+		Orphans:   make([]string, 0),
+	}
+	emails := make(map[string]struct{})
+	ids := make(map[uint64]struct{})
+	var decodeFailed bool
+
+	iter := userdb.NewIterator(nil, nil)
+	for iter.Next() {
+		key := string(iter.Key())
+		if !localdb.IsUserRecord(key) {
+			continue
+		}
+		// The records of a user that fails to decode are not
+		// orphaned, they are repaired along with the user.
+		emails[key] = struct{}{}
+		u, err := localdb.DecodeUser(iter.Value())
+		if err != nil {
+			// Reported by --fsck.
+			decodeFailed = true
+			continue
+		}
+		r.addUser(u)
+		ids[u.ID] = struct{}{}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	r.prune()
+
+	// The id of a user that fails to decode is unknown, so the records
+	// that reference users by id can't be checked.
+	if decodeFailed {
+		ids = nil
+	}
+
+	orphans, err := findOrphans(userdb, emails, ids)
+	if err != nil {
+		return nil, err
+	}
+	r.Orphans = append(r.Orphans, orphans...)
+
+	return &r, nil
+}
+
+// deleteRecords deletes the records with the given keys in a single batch.
+func deleteRecords(keys []string) error {
+	userdb, err := openRawDB()
+	if err != nil {
+		return err
+	}
+	defer userdb.Close()
+
+	batch := new(leveldb.Batch)
+	for _, key := range keys {
+		batch.Delete([]byte(key))
+	}
+	return userdb.Write(batch, nil)
+}
+
+func checkDupesAction() error {
+	r, err := checkDupes()
+	if err != nil {
+		return err
+	}
+	printResult(r, r.print)
+
+	remaining := r.found()
+	if *fix && len(r.Orphans) > 0 {
+		// Only the orphaned records can be repaired automatically,
+		// duplicates need to be resolved with --edituser or
+		// --setusername.
+		diff := fmt.Sprintf("deleted %v orphaned records", len(r.Orphans))
+		if err := confirmChange("checkdupes", diff); err != nil {
+			return err
+		}
+		if err := deleteRecords(r.Orphans); err != nil {
+			return err
+		}
+
+		db, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		if err := audit(db, "checkdupes", "", diff); err != nil {
+			return err
+		}
+
+		fmt.Printf("%v orphaned records deleted\n", len(r.Orphans))
+		remaining -= len(r.Orphans)
+	}
+
+	if remaining > 0 {
+		return fmt.Errorf("duplicates or orphaned records found")
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// envPrefix is the prefix of the environment variables that set flags, e.g.
+// POLITEIAWWW_DBUTIL_DATADIR sets --datadir.
+const envPrefix = "POLITEIAWWW_DBUTIL_"
+
+// envOptions are the flags that can be set from the environment.  They
+// select the database and how the tool runs.  Commands, their parameters and
+// flags such as --yes that change what a command does must be given
+// explicitly.
+var envOptions = map[string]bool{
+	"actor":         true,
+	"configfile":    true,
+	"datadir":       true,
+	"debuglevel":    true,
+	"metricslisten": true,
+	"profile":       true,
+	"testnet":       true,
+}
+
+// envName returns the environment variable of the named flag.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(name)
+}
+
+// applyEnv sets the envOptions flags from the environment.  Flags in
+// explicit, which were given on the command line, take precedence over the
+// environment.  The flags that are set from the environment are added to
+// explicit.
+func applyEnv(explicit map[string]bool) error {
+	// Reject unknown variables so that a typo doesn't silently fall back to
+	// the default.
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, envPrefix) {
+			continue
+		}
+		env := strings.SplitN(kv, "=", 2)[0]
+		name := strings.ToLower(strings.TrimPrefix(env, envPrefix))
+		switch {
+		case cockroachOptions[name]:
+			return fmt.Errorf("%v: the cockroachdb backend is not "+
+				"supported", env)
+		case flag.Lookup(name) == nil:
+			return fmt.Errorf("unknown environment variable %v", env)
+		case !envOptions[name]:
+			return fmt.Errorf("%v: --%v can't be set in the "+
+				"environment", env, name)
+		}
+	}
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if !envOptions[f.Name] {
+			return
+		}
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || err != nil {
+			return
+		}
+
+		if f.Name == "datadir" || f.Name == "configfile" {
+			value = cleanAndExpandPath(value)
+		}
+
+		defaultValues[f.Name] = value
+		if explicit[f.Name] {
+			return
+		}
+		if e := f.Value.Set(value); e != nil {
+			err = fmt.Errorf("invalid value %q for %v: %v", value,
+				envName(f.Name), e)
+			return
+		}
+		explicit[f.Name] = true
+	})
+
+	return err
+}
+
+// loadConfig applies the environment and the profile to the flags that were
+// not given on the command line and validates the result.
+func loadConfig() error {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	if err := applyEnv(explicit); err != nil {
+		return err
+	}
+	if err := applyProfile(explicit); err != nil {
+		return err
+	}
+
+	return validateConfig()
+}
+
+// validateConfig returns an error if the flags conflict or have invalid
+// values.  It runs before the database is opened.
+func validateConfig() error {
+	switch {
+	case *dataDir == "":
+		return fmt.Errorf("--datadir must not be empty")
+	case *format != "" && *format != formatJSON && *format != formatCSV:
+		return fmt.Errorf("invalid --format %v; must be %v or %v",
+			*format, formatJSON, formatCSV)
+	case *skipExisting && *updateExisting:
+		return fmt.Errorf("--skipexisting and --updateexisting can't " +
+			"be combined")
+	case *resume && !*migrate && !*verifyDB:
+		return fmt.Errorf("--resume can only be used with --migrate " +
+			"and --verifydb")
+	case *fix && !*checkDuplicates:
+		return fmt.Errorf("--fix can only be used with --checkdupes")
+	case *offset < 0 || *limit < 0:
+		return fmt.Errorf("--offset and --limit must not be negative")
+	}
+
+	if *metricsListen != "" {
+		if _, _, err := net.SplitHostPort(*metricsListen); err != nil {
+			return fmt.Errorf("invalid --metricslisten: %v", err)
+		}
+	}
+
+	return nil
+}
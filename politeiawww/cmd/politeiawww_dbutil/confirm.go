@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// stdin is shared by the shell and the confirmation prompts so that neither
+// loses input that the other has buffered.
+var stdin = bufio.NewReader(os.Stdin)
+
+// errDryRun is returned by confirmChange when --dryrun is set.  runAction
+// treats it as success.
+var errDryRun = errors.New("dry run, no changes were made")
+
+// readLine reads a single line from stdin without the trailing newline.
+func readLine() (string, error) {
+	line, err := stdin.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// confirmChange prints the change that a command is about to make and asks
+// the operator to confirm it by typing the target, usually the email of the
+// affected user.  The prompt is skipped with --yes.  With --dryrun nothing
+// is asked and errDryRun is returned so that the change isn't written.
+func confirmChange(target, diff string) error {
+	if target != "" {
+		fmt.Printf("Target : %v\n", target)
+	}
+	fmt.Printf("Change : %v\n", diff)
+
+	if *dryRun {
+		return errDryRun
+	}
+	if *yes {
+		return nil
+	}
+
+	// The prompt goes to stderr to keep stdout machine readable.
+	fmt.Fprintf(os.Stderr, "Type %q to confirm: ", target)
+	answer, err := readLine()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if strings.TrimSpace(answer) != target {
+		return fmt.Errorf("not confirmed, no changes were made")
+	}
+
+	return nil
+}
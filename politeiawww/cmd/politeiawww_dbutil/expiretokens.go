@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/decred/politeia/politeiawww/database"
+)
+
+// expireReport counts the expired fields found by --expiretokens.
+type expireReport struct {
+	Users                int `json:"users"`                // Users that were changed
+	ResetPasswordTokens  int `json:"resetpasswordtokens"`  // Cleared tokens
+	UpdateKeyTokens      int `json:"updatekeytokens"`      // Cleared tokens
+	EmailChangeTokens    int `json:"emailchangetokens"`    // Cleared pending email changes
+	UserPaywallPolls     int `json:"userpaywallpolls"`     // Cleared poll windows
+	ProposalPaywallPolls int `json:"proposalpaywallpolls"` // Cleared poll windows
+	ExpiredUnverified    int `json:"expiredunverified"`    // Expired new user tokens, left as is
+}
+
+func (r *expireReport) print() {
+	fmt.Printf("Reset password tokens   : %v\n", r.ResetPasswordTokens)
+	fmt.Printf("Update key tokens       : %v\n", r.UpdateKeyTokens)
+	fmt.Printf("Email change tokens     : %v\n", r.EmailChangeTokens)
+	fmt.Printf("User paywall polls      : %v\n", r.UserPaywallPolls)
+	fmt.Printf("Proposal paywall polls  : %v\n", r.ProposalPaywallPolls)
+	fmt.Printf("Expired, unverified     : %v (not changed)\n",
+		r.ExpiredUnverified)
+	fmt.Printf("%v users cleaned\n", r.Users)
+}
+
+func (r *expireReport) String() string {
+	return fmt.Sprintf("%v users: %v reset password tokens, %v update "+
+		"key tokens, %v email change tokens, %v user paywall polls, %v "+
+		"proposal paywall polls", r.Users, r.ResetPasswordTokens,
+		r.UpdateKeyTokens, r.EmailChangeTokens, r.UserPaywallPolls,
+		r.ProposalPaywallPolls)
+}
+
+// expireUser clears the expired verification tokens and paywall poll
+// windows of the user and returns whether anything was cleared.  Expired
+// fields are cleared the same way politeiawww clears them once they have
+// been used, so the semantics of the user record don't change.
+func expireUser(r *expireReport, u *database.User, now int64) bool {
+	var changed bool
+
+	// A nil new user verification token marks the account as verified, so
+	// expired ones have to stay until the user requests a new one.
+	if u.NewUserVerificationToken != nil &&
+		u.NewUserVerificationExpiry < now {
+		r.ExpiredUnverified++
+	}
+
+	if u.ResetPasswordVerificationToken != nil &&
+		u.ResetPasswordVerificationExpiry < now {
+		u.ResetPasswordVerificationToken = nil
+		u.ResetPasswordVerificationExpiry = 0
+		r.ResetPasswordTokens++
+		changed = true
+	}
+	if u.UpdateKeyVerificationToken != nil &&
+		u.UpdateKeyVerificationExpiry < now {
+		u.UpdateKeyVerificationToken = nil
+		u.UpdateKeyVerificationExpiry = 0
+		r.UpdateKeyTokens++
+		changed = true
+	}
+	if u.EmailChangeVerificationToken != nil &&
+		u.EmailChangeVerificationExpiry < now {
+		database.CancelEmailChange(u)
+		r.EmailChangeTokens++
+		changed = true
+	}
+
+	// politeiawww treats a poll expiry of 0 as expired.
+	if u.NewUserPaywallPollExpiry != 0 && u.NewUserPaywallPollExpiry < now {
+		u.NewUserPaywallPollExpiry = 0
+		r.UserPaywallPolls++
+		changed = true
+	}
+	for i := range u.ProposalPaywalls {
+		p := &u.ProposalPaywalls[i]
+		if p.PollExpiry != 0 && p.PollExpiry < now {
+			p.PollExpiry = 0
+			r.ProposalPaywallPolls++
+			changed = true
+		}
+	}
+
+	if changed {
+		r.Users++
+	}
+	return changed
+}
+
+func expireTokensAction() error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// The users can't be updated while AllUsers holds the database lock.
+	var (
+		r     expireReport
+		users []database.User
+	)
+	now := time.Now().Unix()
+	prog := newProgress("expiretokens", 0, 0)
+	err = db.AllUsers(func(u *database.User) {
+		prog.add(1)
+		if expireUser(&r, u, now) {
+			users = append(users, *u)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	prog.finish()
+
+	if len(users) == 0 {
+		printResult(r, r.print)
+		return nil
+	}
+
+	err = confirmChange("expiretokens", fmt.Sprintf("clear expired "+
+		"tokens and paywall polls of %v", r.String()))
+	if err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		if err := db.UserUpdate(u); err != nil {
+			return fmt.Errorf("user with email %v: %v", u.Email, err)
+		}
+	}
+
+	if err := audit(db, "expiretokens", "", r.String()); err != nil {
+		return err
+	}
+
+	printResult(r, r.print)
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/decred/politeia/politeiawww/database"
+	"github.com/decred/politeia/politeiawww/database/localdb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// exportedSession is a session of the exported user.  The encoded session
+// values are not exported since they only hold what the session ID already
+// identifies.
+type exportedSession struct {
+	ID        string `json:"id"`
+	CreatedAt int64  `json:"createdat"`
+	Expiry    int64  `json:"expiry"`
+}
+
+// userExport is everything that is stored about a user.  Comments and their
+// access times are stored by politeiad and are not part of the export.
+type userExport struct {
+	Exported     int64                      `json:"exported"`     // Unix timestamp of the export
+	User         map[string]json.RawMessage `json:"user"`         // Profile, identities, paywalls and credits
+	History      []map[string]interface{}   `json:"history"`      // Previous versions of the user record
+	Preferences  *database.UserPreferences  `json:"preferences"`  // Nil if the user never saved any
+	Sessions     []exportedSession          `json:"sessions"`     // Sessions of the user
+	QueuedEmails []database.QueuedEmail     `json:"queuedemails"` // Undelivered emails to the user
+	AuditLog     []database.AuditEntry      `json:"auditlog"`     // Admin actions on the user
+}
+
+// userSessions returns the sessions that belong to the user.  The database
+// interface has no way to look them up by user, so the records are read
+// directly.
+func userSessions(userID uint64, redact bool) ([]exportedSession, error) {
+	userdb, err := openRawDB()
+	if err != nil {
+		return nil, err
+	}
+	defer userdb.Close()
+
+	sessions := make([]exportedSession, 0)
+	iter := userdb.NewIterator(util.BytesPrefix([]byte(localdb.SessionPrefix)),
+		nil)
+	for iter.Next() {
+		s, err := localdb.DecodeSession(iter.Value())
+		if err != nil {
+			iter.Release()
+			return nil, fmt.Errorf("session %v: %v", string(iter.Key()),
+				err)
+		}
+		if s.UserID != userID {
+			continue
+		}
+		id := s.ID
+		if redact {
+			id = redacted
+		}
+		sessions = append(sessions, exportedSession{
+			ID:        id,
+			CreatedAt: s.CreatedAt,
+			Expiry:    s.Expiry,
+		})
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// exportUser collects everything that is stored about the user, except for
+// the sessions.
+func exportUser(db database.Database, u *database.User, redact bool) (*userExport, error) {
+	var err error
+	e := userExport{
+		Exported:     time.Now().Unix(),
+		QueuedEmails: make([]database.QueuedEmail, 0),
+		AuditLog:     make([]database.AuditEntry, 0),
+	}
+	e.User, err = userValues(u, redact)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := db.UserHistory(u.Email)
+	if err != nil {
+		return nil, err
+	}
+	e.History, err = historyValues(history, redact)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Preferences, err = db.UserPreferencesGet(u.ID)
+	if err != nil && err != database.ErrPreferencesNotFound {
+		return nil, err
+	}
+
+	// Emails and audit entries refer to the user by email, which may have
+	// changed.
+	emails := map[string]bool{u.Email: true}
+	for _, h := range history {
+		emails[strings.ToLower(h.User.Email)] = true
+	}
+
+	err = db.AllQueuedEmails(func(q *database.QueuedEmail) {
+		for _, to := range append(q.To, q.BCC...) {
+			if !emails[strings.ToLower(to)] {
+				continue
+			}
+			// The body contains verification links.
+			if redact {
+				q.Body = redacted
+			}
+			e.QueuedEmails = append(e.QueuedEmails, *q)
+			return
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.AuditLog(0, 0, func(a *database.AuditEntry) {
+		if emails[strings.ToLower(a.Target)] {
+			e.AuditLog = append(e.AuditLog, *a)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// exportUserAction writes everything that is stored about a user as JSON to
+// stdout or a file, e.g. to answer a data access request.  Sensitive fields
+// are redacted unless --unredacted is set.
+func exportUserAction() error {
+	args := flag.Args()
+	if len(args) < 1 || len(args) > 2 {
+		flag.Usage()
+		return nil
+	}
+	email := strings.ToLower(args[0])
+	redact := !*unredacted
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	u, err := db.UserGet(email)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("user with email %v: %v", email, err)
+	}
+	e, err := exportUser(db, u, redact)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	if err = db.Close(); err != nil {
+		return err
+	}
+
+	e.Sessions, err = userSessions(u.ID, redact)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	target := "stdout"
+	if len(args) == 2 {
+		target = args[1]
+		if err = ioutil.WriteFile(target, append(b, '\n'), 0600); err != nil {
+			return err
+		}
+	}
+
+	// Exports can contain personal data, so who exported what is
+	// recorded.
+	db, err = openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	diff := fmt.Sprintf("exported to %v", target)
+	if !redact {
+		diff += ", unredacted"
+	}
+	if err = audit(db, "exportuser", email, diff); err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		result = e
+		return nil
+	}
+	if len(args) == 2 {
+		fmt.Fprintf(os.Stderr, "User %v exported to %v\n", email, target)
+		return nil
+	}
+	_, err = fmt.Printf("%s\n", b)
+	return err
+}
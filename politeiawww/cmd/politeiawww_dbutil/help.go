@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// commandFlags are the flags that select the command to run.  All other
+// flags are options of the commands.
+var commandFlags = map[string]bool{
+	"addcredits":        true,
+	"auditlog":          true,
+	"checkdupes":        true,
+	"clearpaywall":      true,
+	"deactivateuser":    true,
+	"disable2fa":        true,
+	"dump":              true,
+	"edituser":          true,
+	"emailqueue":        true,
+	"expiretokens":      true,
+	"exportuser":        true,
+	"flushemails":       true,
+	"fsck":              true,
+	"identities":        true,
+	"import":            true,
+	"listinvites":       true,
+	"migrate":           true,
+	"reactivateuser":    true,
+	"reconcilepaywalls": true,
+	"resetpassword":     true,
+	"searchusers":       true,
+	"sendinvite":        true,
+	"setadmin":          true,
+	"setemail":          true,
+	"setusername":       true,
+	"setversion":        true,
+	"shell":             true,
+	"stats":             true,
+	"stubusers":         true,
+	"userhistory":       true,
+	"verifydb":          true,
+}
+
+// selectedCommand returns the name of the first command flag that is set on
+// the command line, or an empty string if there is none.
+func selectedCommand() string {
+	var name string
+	flag.Visit(func(f *flag.Flag) {
+		if name == "" && commandFlags[f.Name] {
+			name = f.Name
+		}
+	})
+	return name
+}
+
+// splitUsage splits the usage of a flag into its description and the
+// parameters of the command, which follow "Parameters:".
+func splitUsage(usage string) (string, string) {
+	i := strings.Index(usage, "Parameters:")
+	if i == -1 {
+		return usage, ""
+	}
+	return strings.TrimSpace(usage[:i]),
+		strings.TrimSpace(usage[i+len("Parameters:"):])
+}
+
+// flagSynopsis returns the flag as it is given on the command line, e.g.
+// "--datadir <string>" or "--setadmin <email> <true/false>".
+func flagSynopsis(f *flag.Flag) string {
+	name, _ := flag.UnquoteUsage(f)
+	_, params := splitUsage(f.Usage)
+	switch {
+	case params != "":
+		return "--" + f.Name + " " + params
+	case name != "":
+		return "--" + f.Name + " <" + name + ">"
+	default:
+		return "--" + f.Name
+	}
+}
+
+// printFlags prints the synopsis and usage of the flags with the given
+// names.
+func printFlags(names []string) {
+	for _, name := range names {
+		f := flag.Lookup(name)
+		desc, _ := splitUsage(f.Usage)
+		fmt.Printf("  %v\n", flagSynopsis(f))
+		fmt.Printf("      %v\n", desc)
+		if !commandFlags[name] && f.DefValue != "" &&
+			f.DefValue != "false" && f.DefValue != "0" {
+			fmt.Printf("      Default: %v\n", f.DefValue)
+		}
+	}
+}
+
+// helpTopics returns the sorted names of the command and option flags.
+func helpTopics() ([]string, []string) {
+	var commands, options []string
+	flag.VisitAll(func(f *flag.Flag) {
+		if commandFlags[f.Name] {
+			commands = append(commands, f.Name)
+		} else {
+			options = append(options, f.Name)
+		}
+	})
+	sort.Strings(commands)
+	sort.Strings(options)
+	return commands, options
+}
+
+// helpAction prints the help of a command or option, which is generated from
+// the flag definitions.  Without a topic the commands are listed.  The
+// options of a command are the options whose usage refers to it.
+func helpAction(args []string) error {
+	commands, options := helpTopics()
+	if len(args) == 0 {
+		fmt.Printf("Usage: %v [options] --<command> [parameters]\n\n",
+			os.Args[0])
+		fmt.Printf("Commands:\n")
+		printFlags(commands)
+		fmt.Printf("\nRun help <command> for the options of a command " +
+			"or help options for all options.\n")
+		return nil
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("help takes a single topic")
+	}
+
+	topic := strings.TrimLeft(args[0], "-")
+	if topic == "options" {
+		fmt.Printf("Options:\n")
+		printFlags(options)
+		return nil
+	}
+
+	f := flag.Lookup(topic)
+	if f == nil {
+		return fmt.Errorf("unknown help topic %v; run help for a list "+
+			"of commands", args[0])
+	}
+	if !commandFlags[topic] {
+		printFlags([]string{topic})
+		return nil
+	}
+
+	desc, _ := splitUsage(f.Usage)
+	fmt.Printf("Usage: %v [options] %v\n\n", os.Args[0], flagSynopsis(f))
+	fmt.Printf("%v\n", desc)
+
+	var related []string
+	for _, name := range options {
+		if strings.Contains(flag.Lookup(name).Usage, "--"+topic) {
+			related = append(related, name)
+		}
+	}
+	if len(related) > 0 {
+		fmt.Printf("\nOptions:\n")
+		printFlags(related)
+	}
+	fmt.Printf("\nRun help options for all options.\n")
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/decred/politeia/politeiawww/database"
+)
+
+// inviteStatus returns a description of whether the invitation can still be
+// redeemed.
+func inviteStatus(i *database.Invitation, now time.Time) string {
+	switch database.CheckInvitation(i, now) {
+	case nil:
+		return "pending"
+	case database.ErrInviteRedeemed:
+		return "redeemed"
+	default:
+		return "expired"
+	}
+}
+
+// sendInviteAction creates an invitation to register and prints the invite
+// token, which has to be sent to the invitee.  Only its hash is stored, so
+// it can't be printed again.
+func sendInviteAction() error {
+	args := flag.Args()
+	if len(args) != 2 {
+		flag.Usage()
+		return nil
+	}
+	email := strings.ToLower(args[0])
+	inviterEmail := args[1]
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	inviter, err := db.UserGet(inviterEmail)
+	if err != nil {
+		return fmt.Errorf("user with email %v: %v", inviterEmail, err)
+	}
+	if !inviter.Admin {
+		return fmt.Errorf("user with email %v is not an admin",
+			inviterEmail)
+	}
+
+	_, err = db.UserGet(email)
+	switch err {
+	case nil:
+		return fmt.Errorf("user with email %v: %v", email,
+			database.ErrUserExists)
+	case database.ErrUserNotFound:
+	default:
+		return err
+	}
+
+	token, i, err := database.NewInvitation(email, inviter.ID, time.Now())
+	if err != nil {
+		return fmt.Errorf("user with email %v: %v", email, err)
+	}
+
+	diff := fmt.Sprintf("invited by %v, expires %v", inviter.Email,
+		time.Unix(i.Expiry, 0))
+	if err = confirmChange(email, diff); err != nil {
+		return err
+	}
+
+	if err = db.InviteNew(*i); err != nil {
+		return err
+	}
+	if err = audit(db, "sendinvite", email, diff); err != nil {
+		return err
+	}
+
+	t := hex.EncodeToString(token)
+	printResult(map[string]interface{}{
+		"email":  email,
+		"token":  t,
+		"expiry": i.Expiry,
+	}, func() {
+		fmt.Printf("Invite token of %v: %v\n", email, t)
+		fmt.Printf("Expires: %v\n", time.Unix(i.Expiry, 0))
+	})
+	return nil
+}
+
+func listInvitesAction() error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	invites := make([]*database.Invitation, 0)
+	err = db.AllInvites(func(i *database.Invitation) {
+		invites = append(invites, i)
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	printResult(invites, func() {
+		for _, i := range invites {
+			fmt.Printf("%v\n", strings.Repeat("=", 80))
+			fmt.Printf("Hash     : %x\n", i.TokenHash)
+			fmt.Printf("Status   : %v\n", inviteStatus(i, now))
+			fmt.Printf("Email    : %v\n", i.Email)
+			fmt.Printf("Inviter  : %v\n", i.InviterID)
+			fmt.Printf("Created  : %v\n", time.Unix(i.CreatedAt, 0))
+			fmt.Printf("Expires  : %v\n", time.Unix(i.Expiry, 0))
+			if i.RedeemedAt != 0 {
+				fmt.Printf("Redeemed : %v by user %v\n",
+					time.Unix(i.RedeemedAt, 0), i.RedeemedBy)
+			}
+		}
+		fmt.Printf("%v invitations\n", len(invites))
+	})
+	return nil
+}
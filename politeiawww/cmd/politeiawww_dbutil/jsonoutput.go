@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"strings"
+)
+
+// jsonReport is written to stdout for every command when --json is set.
+type jsonReport struct {
+	Database string            `json:"database"`
+	Flags    map[string]string `json:"flags"`            // Flags that differ from their defaults
+	Args     []string          `json:"args"`             // Command parameters
+	OK       bool              `json:"ok"`               // Whether the command succeeded
+	Error    string            `json:"error,omitempty"`  // Why the command failed
+	ExitCode int               `json:"exitcode"`         // Exit code of the process
+	Result   interface{}       `json:"result,omitempty"` // Structured result, if the command has one
+	Output   []string          `json:"output"`           // Lines the command printed
+}
+
+// errReported is returned by runJSON when the command failed and the error
+// has already been written to stdout.
+var errReported = errors.New("error reported")
+
+// result is the structured result of the current command.  It is only set
+// with --json; commands without a structured result only report the lines
+// they print.
+var result interface{}
+
+// printResult sets the structured result of the command with --json and
+// otherwise calls print to write the human readable output.
+func printResult(v interface{}, print func()) {
+	if *jsonOutput {
+		result = v
+		return
+	}
+	print()
+}
+
+// captureStdout runs f and returns the lines it printed to stdout.  The pipe
+// is drained completely, regardless of the length of the lines, so f never
+// blocks on a full pipe.
+func captureStdout(f func() error) ([]string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&buf, r)
+		close(done)
+	}()
+
+	stdout := os.Stdout
+	os.Stdout = w
+	err = f()
+	os.Stdout = stdout
+
+	w.Close()
+	<-done
+	r.Close()
+
+	lines := make([]string, 0)
+	out := strings.TrimSuffix(buf.String(), "\n")
+	if buf.Len() > 0 {
+		for _, line := range strings.Split(out, "\n") {
+			lines = append(lines, strings.TrimSuffix(line, "\r"))
+		}
+	}
+
+	return lines, err
+}
+
+// runJSON runs the command selected by the flags and writes a jsonReport
+// with its outcome to stdout.
+func runJSON(net string) error {
+	result = nil
+	output, err := captureStdout(func() error {
+		if err := checkDBDir(); err != nil {
+			return err
+		}
+		if *shell {
+			return errors.New("--json can't be used to start the shell")
+		}
+		if *editUser && len(sets) == 0 {
+			return errors.New("--edituser requires --set with --json")
+		}
+		return runAction(net)
+	})
+
+	report := jsonReport{
+		Database: dbDir,
+		Flags:    make(map[string]string),
+		Args:     flag.Args(),
+		OK:       err == nil,
+		Result:   result,
+		Output:   output,
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		if v := f.Value.String(); v != f.DefValue {
+			report.Flags[f.Name] = v
+		}
+	})
+	if err != nil {
+		report.Error = err.Error()
+		report.ExitCode = 1
+	}
+	if report.Args == nil {
+		report.Args = []string{}
+	}
+
+	b, jerr := json.Marshal(report)
+	if jerr != nil {
+		return jerr
+	}
+	os.Stdout.Write(append(b, '\n'))
+
+	if err != nil {
+		return errReported
+	}
+	return nil
+}
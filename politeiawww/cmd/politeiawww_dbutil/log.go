@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/decred/politeia/politeiawww/database/localdb"
+	"github.com/decred/slog"
+)
+
+// Loggers per subsystem.  They write to stderr so that log output doesn't
+// mix with the output of the commands.  When adding new subsystems, add the
+// subsystem logger variable here and to the subsystemLoggers map.
+var (
+	backendLog = slog.NewBackend(os.Stderr)
+
+	log        = backendLog.Logger("DBUT")
+	localdbLog = backendLog.Logger("LODB")
+)
+
+// subsystemLoggers maps each subsystem identifier to its associated logger.
+var subsystemLoggers = map[string]slog.Logger{
+	"DBUT": log,
+	"LODB": localdbLog,
+}
+
+func init() {
+	localdb.UseLogger(localdbLog)
+	setLogLevels(defaultLogLevel)
+}
+
+// defaultLogLevel keeps the logs quiet unless --debuglevel is given.
+const defaultLogLevel = "warn"
+
+// validLogLevel returns whether or not logLevel is a valid debug log level.
+func validLogLevel(logLevel string) bool {
+	_, ok := slog.LevelFromString(logLevel)
+	return ok
+}
+
+// setLogLevels sets the log level for all subsystem loggers to the passed
+// level.
+func setLogLevels(logLevel string) {
+	level, _ := slog.LevelFromString(logLevel)
+	for _, logger := range subsystemLoggers {
+		logger.SetLevel(level)
+	}
+}
+
+// supportedSubsystems returns a sorted slice of the supported subsystems for
+// logging purposes.
+func supportedSubsystems() []string {
+	subsystems := make([]string, 0, len(subsystemLoggers))
+	for subsysID := range subsystemLoggers {
+		subsystems = append(subsystems, subsysID)
+	}
+	sort.Strings(subsystems)
+	return subsystems
+}
+
+// parseAndSetDebugLevels parses the --debuglevel flag and sets the levels
+// accordingly.  It accepts the same syntax as politeiawww: a single level
+// for all subsystems or <subsystem>=<level> pairs separated by commas.
+func parseAndSetDebugLevels(debugLevel string) error {
+	if !strings.Contains(debugLevel, ",") && !strings.Contains(debugLevel, "=") {
+		if !validLogLevel(debugLevel) {
+			return fmt.Errorf("the specified debug level [%v] is invalid",
+				debugLevel)
+		}
+		setLogLevels(debugLevel)
+		return nil
+	}
+
+	for _, logLevelPair := range strings.Split(debugLevel, ",") {
+		fields := strings.Split(logLevelPair, "=")
+		if len(fields) != 2 {
+			return fmt.Errorf("the specified debug level contains an "+
+				"invalid subsystem/level pair [%v]", logLevelPair)
+		}
+		subsysID, logLevel := fields[0], fields[1]
+
+		logger, ok := subsystemLoggers[subsysID]
+		if !ok {
+			return fmt.Errorf("the specified subsystem [%v] is invalid "+
+				"-- supported subsystems %v", subsysID,
+				supportedSubsystems())
+		}
+		level, ok := slog.LevelFromString(logLevel)
+		if !ok {
+			return fmt.Errorf("the specified debug level [%v] is invalid",
+				logLevel)
+		}
+		logger.SetLevel(level)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+var (
+	// metricsMtx protects the progress of the running command, which is
+	// read by the metrics server.
+	metricsMtx sync.Mutex
+
+	// progresses holds the latest progress of every stage of the running
+	// command, e.g. verify and migrate for --migrate.
+	progresses = make(map[string]*progress)
+)
+
+// registerProgress makes the progress of a stage available to the metrics
+// server.
+func registerProgress(p *progress) {
+	metricsMtx.Lock()
+	progresses[p.name] = p
+	metricsMtx.Unlock()
+}
+
+// writeMetrics writes the progress of every stage in the Prometheus text
+// exposition format.
+func writeMetrics(w io.Writer) {
+	metricsMtx.Lock()
+	defer metricsMtx.Unlock()
+
+	stages := make([]string, 0, len(progresses))
+	for name := range progresses {
+		stages = append(stages, name)
+	}
+	sort.Strings(stages)
+
+	metric := func(name, help string, value func(p *progress) float64) {
+		fmt.Fprintf(w, "# HELP dbutil_%v %v\n", name, help)
+		fmt.Fprintf(w, "# TYPE dbutil_%v gauge\n", name)
+		for _, stage := range stages {
+			fmt.Fprintf(w, "dbutil_%v{stage=%q} %v\n", name, stage,
+				value(progresses[stage]))
+		}
+	}
+
+	metric("records_processed", "Records processed by the stage.",
+		func(p *progress) float64 { return float64(p.done) })
+	metric("records_total", "Records the stage will process, 0 if unknown.",
+		func(p *progress) float64 { return float64(p.total) })
+	metric("records_per_second", "Records processed per second.",
+		func(p *progress) float64 { return p.rate() })
+	metric("failures", "Records that failed a check.",
+		func(p *progress) float64 { return float64(p.failures) })
+	metric("eta_seconds", "Estimated time left, -1 if unknown.",
+		func(p *progress) float64 {
+			left, ok := p.eta()
+			if !ok {
+				return -1
+			}
+			return left.Seconds()
+		})
+}
+
+// startMetricsServer serves /metrics on addr for as long as the process runs.
+func startMetricsServer(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("metrics: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w)
+	})
+	go func() {
+		if err := http.Serve(l, mux); err != nil {
+			log.Errorf("metrics server: %v", err)
+		}
+	}()
+
+	log.Infof("Serving metrics on %v/metrics", l.Addr())
+	return nil
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"crypto/rand"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/user"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -19,52 +23,195 @@ import (
 	"github.com/decred/politeia/politeiawww/sharedconfig"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	addCredits = flag.Bool("addcredits", false, "Add proposal credits to a user's account. Parameters: <email> <quantity>")
-	dataDir    = flag.String("datadir", sharedconfig.DefaultDataDir, "Specify the politeiawww data directory.")
-	dumpDb     = flag.Bool("dump", false, "Dump the entire politeiawww database contents or contents for a specific user. Parameters: [email]")
-	setAdmin   = flag.Bool("setadmin", false, "Set the admin flag for a user. Parameters: <email> <true/false>")
-	testnet    = flag.Bool("testnet", false, "Whether to check the testnet database or not.")
-	dbDir      = ""
+	actor             = flag.String("actor", "", "Name recorded in the audit log for commands that modify the database. Defaults to the current OS user.")
+	addCredits        = flag.Bool("addcredits", false, "Add proposal credits to a user's account. Parameters: <email> <quantity>")
+	filterAdmin       = flag.Bool("admin", false, "Only match admins with --searchusers.")
+	auditLog          = flag.Bool("auditlog", false, "Print the audit log of admin actions, optionally limited to a date range. Parameters: [since YYYY-MM-DD] [until YYYY-MM-DD]")
+	checkDuplicates   = flag.Bool("checkdupes", false, "Find duplicate usernames, user ids and paywall addresses and records of users that don't exist, exits with an error if any are found.")
+	clearPaywall      = flag.Bool("clearpaywall", false, "Mark the registration paywall of a user as paid. Parameters: <email>")
+	profileFile       = flag.String("configfile", defaultProfileFile, "Path to the config file with the profiles selectable with --profile.")
+	count             = flag.Int("count", 10, "Number of users created by --stubusers.")
+	createdAfter      = flag.String("createdafter", "", "Only match users created on or after the date (YYYY-MM-DD) with --searchusers.")
+	dataDir           = flag.String("datadir", sharedconfig.DefaultDataDir, "Specify the politeiawww data directory.")
+	deactivated       = flag.Bool("deactivated", false, "Only match deactivated users with --searchusers.")
+	deactivateIDs     = flag.Bool("deactivateidentities", false, "Also deactivate all identities of the user with --deactivateuser.")
+	deactivateUser    = flag.Bool("deactivateuser", false, "Deactivate a user account and log it out. Parameters: <email>")
+	debugLevel        = flag.String("debuglevel", defaultLogLevel, "Logging level for all subsystems {trace, debug, info, warn, error, critical, off}, or <subsystem>=<level> pairs separated by commas. Subsystems: DBUT, LODB.")
+	disable2FA        = flag.Bool("disable2fa", false, "Disable the two-factor authentication of a user that is locked out. Parameters: <email>")
+	dryRun            = flag.Bool("dryrun", false, "Print the changes that a command would make without writing them.")
+	dumpDb            = flag.Bool("dump", false, "Dump the entire politeiawww database contents or contents for a specific user. Parameters: [email|username|id]")
+	editUser          = flag.Bool("edituser", false, "Edit a user record in $EDITOR, or apply --set field=value assignments. Parameters: <email>")
+	emailQueue        = flag.Bool("emailqueue", false, "List the emails that are waiting to be delivered.")
+	emailRegex        = flag.String("emailregex", "", "Only match users whose email matches the regular expression with --searchusers.")
+	expireTokens      = flag.Bool("expiretokens", false, "Clear the expired reset password, update key and email change tokens and paywall poll windows of all users.")
+	exportUserFlag    = flag.Bool("exportuser", false, "Write everything that is stored about a user as JSON to stdout or a file, e.g. for a data access request. Parameters: <email> [file]")
+	fields            = flag.String("fields", "", "Comma separated list of user fields to include in the json and csv output of --dump, e.g. email,username,admin.")
+	fix               = flag.Bool("fix", false, "Delete the orphaned records found by --checkdupes.")
+	flushEmail        = flag.Bool("flushemails", false, "Remove all queued emails or a specific email from the queue. Parameters: [id]")
+	format            = flag.String("format", "", "Dump user records with --dump as json or csv instead of printing the raw database contents.")
+	fsck              = flag.Bool("fsck", false, "Verify the integrity of every record in the database.")
+	identities        = flag.Bool("identities", false, "List, activate or deactivate the identities of a user. Parameters: <email> [activate|deactivate <pubkey>]")
+	importDb          = flag.Bool("import", false, "Import user records from a JSON dump. Parameters: <file>")
+	jsonOutput        = flag.Bool("json", false, "Write the outcome of the command to stdout as a single JSON object.")
+	limit             = flag.Int("limit", 0, "Maximum number of users printed by --searchusers. 0 means no limit.")
+	listInvites       = flag.Bool("listinvites", false, "List the registration invitations and whether they are pending, expired or redeemed.")
+	metricsListen     = flag.String("metricslisten", "", "Serve the progress of long running commands as Prometheus metrics on /metrics at the given address, e.g. localhost:9400.")
+	migrate           = flag.Bool("migrate", false, "Copy every record to the database in another data directory. Parameters: <datadir>")
+	minConfirmations  = flag.Uint64("minconfirmations", 2, "Minimum number of confirmations of payments found by --reconcilepaywalls.")
+	noProposals       = flag.Bool("noproposals", false, "Only match users that have not spent any proposal credits with --searchusers.")
+	offset            = flag.Int("offset", 0, "Number of matching users skipped by --searchusers.")
+	creditPrice       = flag.Uint64("price", 0, "Price in atoms recorded on proposal credits granted with --addcredits.")
+	profile           = flag.String("profile", "", "Use the flag values of the named profile in the config file. Flags on the command line take precedence.")
+	reactivateUser    = flag.Bool("reactivateuser", false, "Reactivate a deactivated user account. Parameters: <email>")
+	reason            = flag.String("reason", "", "Reason recorded in the audit log with --deactivateuser, --reactivateuser and --disable2fa.")
+	reconcilePaywalls = flag.Bool("reconcilepaywalls", false, "Look up payments to unpaid registration and proposal paywalls with dcrdata, e.g. after a polling outage. Parameters: <dcrdata api url>")
+	resetPass         = flag.Bool("resetpassword", false, "Set a temporary password, or the given bcrypt hash, and unlock the user. Parameters: <email> [hash]")
+	resume            = flag.Bool("resume", false, "Resume an interrupted --migrate or --verifydb from its checkpoint.")
+	searchUsers       = flag.Bool("searchusers", false, "Print the users that match all of the given filters.")
+	sendInvite        = flag.Bool("sendinvite", false, "Create an invitation to register and print the invite token to send to the invitee. Parameters: <email> <inviter admin email>")
+	setAdmin          = flag.Bool("setadmin", false, "Set the admin flag for a user. Parameters: <email> <true/false>")
+	setEmail          = flag.Bool("setemail", false, "Change the email of a user. Parameters: <email> <new email>")
+	setUsername       = flag.Bool("setusername", false, "Change the username of a user. Parameters: <email> <new username>")
+	setVersion        = flag.Bool("setversion", false, "Rewrite the database version record after verifying every record. Parameters: [version]")
+	shell             = flag.Bool("shell", false, "Start an interactive shell that keeps the database open between commands.")
+	skipExisting      = flag.Bool("skipexisting", false, "Skip users that already exist with --import.")
+	stats             = flag.Bool("stats", false, "Print a summary of the user records.")
+	stubPassword      = flag.String("stubpassword", "password", "Password of the users created by --stubusers.")
+	stubPaywall       = flag.Bool("stubpaywall", false, "Give the users created by --stubusers unpaid, paid and cleared registration paywalls.")
+	stubUsers         = flag.Bool("stubusers", false, "Create fake users in the testnet database for development and load testing.")
+	testnet           = flag.Bool("testnet", false, "Whether to check the testnet database or not.")
+	unpaid            = flag.Bool("unpaid", false, "Only match users that have not paid their registration paywall with --searchusers.")
+	unredacted        = flag.Bool("unredacted", false, "Include password hashes and verification tokens in the output of --dump, --userhistory and --exportuser.")
+	updateExisting    = flag.Bool("updateexisting", false, "Overwrite users that already exist with the imported fields with --import.")
+	userHist          = flag.Bool("userhistory", false, "Print the retained previous versions of a user record. Parameters: <email>")
+	verifyDB          = flag.Bool("verifydb", false, "Verify every record and the invariants between records, exits with an error if any check fails.")
+	yes               = flag.Bool("yes", false, "Don't ask for confirmation before changing the database.")
+	dbDir             = ""
+
+	sets setFlags
 )
 
-func dumpAction() error {
-	userdb, err := leveldb.OpenFile(dbDir, &opt.Options{
+// openDB opens the politeiawww user database through the localdb backend so
+// that record checksums are maintained on writes.  In shell mode the
+// database stays open between commands.
+func openDB() (database.Database, error) {
+	log.Debugf("Opening database %v", dbDir)
+	if !inShell {
+		return localdb.New(filepath.Dir(dbDir))
+	}
+
+	if shellDB == nil {
+		db, err := localdb.New(filepath.Dir(dbDir))
+		if err != nil {
+			return nil, err
+		}
+		shellDB = db
+	}
+	return shellDatabase{shellDB}, nil
+}
+
+// openRawDB opens the leveldb database directly for actions that need to
+// see every record as stored.
+func openRawDB() (*leveldb.DB, error) {
+	// leveldb only allows a single open handle.
+	if err := closeShellDB(); err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Opening raw database %v", dbDir)
+
+	return leveldb.OpenFile(dbDir, &opt.Options{
 		ErrorIfMissing: true,
 	})
+}
+
+// auditActor returns the name that is recorded as the actor of audit log
+// entries.
+func auditActor() string {
+	if *actor != "" {
+		return *actor
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return "unknown"
+	}
+	return u.Username
+}
+
+// audit records a change made by politeiawww_dbutil in the audit log.
+func audit(db database.Database, action, target, diff string) error {
+	err := db.AuditLogAppend(database.AuditEntry{
+		Actor:  auditActor(),
+		Action: action,
+		Target: target,
+		Diff:   diff,
+	})
 	if err != nil {
-		return err
+		return fmt.Errorf("audit log: %v", err)
 	}
-	defer userdb.Close()
 
-	// If email is provided, only dump that user.
+	return nil
+}
+
+// dumpedUser returns the user as it is printed by --dump, with the sensitive
+// fields redacted unless --unredacted is set.
+func dumpedUser(u database.User) database.User {
+	if *unredacted {
+		return u
+	}
+	return redactUser(u)
+}
+
+func dumpAction() error {
+	if *format != "" {
+		return dumpUsersAction()
+	}
+
+	// If a user is provided, only dump that user.
 	args := flag.Args()
 	if len(args) == 1 {
-		email := []byte(args[0])
-		value, err := userdb.Get(email, nil)
+		userdb, err := openRawDB()
 		if err != nil {
 			return err
 		}
+		defer userdb.Close()
 
-		u, err := localdb.DecodeUser(value)
+		u, err := lookupRawUser(userdb, args[0])
 		if err != nil {
-			return err
+			return fmt.Errorf("user %v: %v", args[0], err)
 		}
 
-		fmt.Printf("Key    : %v\n", hex.EncodeToString(email))
-		fmt.Printf("Record : %v", spew.Sdump(u))
+		fmt.Printf("Key    : %v\n", hex.EncodeToString([]byte(u.Email)))
+		fmt.Printf("Record : %v", spew.Sdump(dumpedUser(*u)))
 		return nil
 	}
 
+	userdb, err := openRawDB()
+	if err != nil {
+		return err
+	}
+	defer userdb.Close()
+
 	iter := userdb.NewIterator(nil, nil)
 	for iter.Next() {
 		fmt.Printf("%v\n", strings.Repeat("=", 80))
 		key := iter.Key()
 		value := iter.Value()
 
-		if string(key) == localdb.UserVersionKey {
+		if localdb.IsUserRecord(string(key)) {
+			u, err := localdb.DecodeUser(value)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Key    : %v\n", hex.EncodeToString(key))
+			fmt.Printf("Record : %v", spew.Sdump(dumpedUser(*u)))
+		} else if string(key) == localdb.UserVersionKey {
 			v, err := localdb.DecodeVersion(value)
 			if err != nil {
 				return err
@@ -72,17 +219,70 @@ func dumpAction() error {
 
 			fmt.Printf("Key    : %v\n", string(key))
 			fmt.Printf("Record : %v\n", spew.Sdump(v))
-		} else if string(key) == localdb.LastUserIdKey {
+		} else if string(key) == localdb.LastUserIdKey ||
+			strings.HasPrefix(string(key), localdb.CounterPrefix) {
 			fmt.Printf("Key    : %v\n", string(key))
 			fmt.Printf("Record : %v\n", binary.LittleEndian.Uint64(value))
-		} else {
-			u, err := localdb.DecodeUser(value)
+		} else if strings.HasPrefix(string(key), localdb.OperationPrefix) {
+			fmt.Printf("Key    : %v\n", string(key))
+			fmt.Printf("Record : %v\n", time.Unix(int64(
+				binary.LittleEndian.Uint64(value)), 0))
+		} else if strings.HasPrefix(string(key), localdb.SessionPrefix) {
+			s, err := localdb.DecodeSession(value)
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("Key    : %v\n", hex.EncodeToString(key))
-			fmt.Printf("Record : %v", spew.Sdump(u))
+			fmt.Printf("Key    : %v\n", string(key))
+			fmt.Printf("Record : %v", spew.Sdump(s))
+		} else if strings.HasPrefix(string(key), localdb.EmailQueuePrefix) {
+			e, err := localdb.DecodeQueuedEmail(value)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Key    : %v\n", string(key))
+			fmt.Printf("Record : %v", spew.Sdump(e))
+		} else if strings.HasPrefix(string(key), localdb.UserHistoryPrefix) {
+			h, err := localdb.DecodeUserHistoryEntry(value)
+			if err != nil {
+				return err
+			}
+			h.User = dumpedUser(h.User)
+
+			fmt.Printf("Key    : %v\n", string(key))
+			fmt.Printf("Record : %v", spew.Sdump(h))
+		} else if strings.HasPrefix(string(key), localdb.AuditPrefix) {
+			a, err := localdb.DecodeAuditEntry(value)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Key    : %v\n", string(key))
+			fmt.Printf("Record : %v", spew.Sdump(a))
+		} else if strings.HasPrefix(string(key), localdb.PreferencesPrefix) {
+			p, err := localdb.DecodeUserPreferences(value)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Key    : %v\n", string(key))
+			fmt.Printf("Record : %v", spew.Sdump(p))
+		} else if strings.HasPrefix(string(key), localdb.InvitePrefix) {
+			i, err := localdb.DecodeInvitation(value)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Key    : %v\n", string(key))
+			fmt.Printf("Record : %v", spew.Sdump(i))
+		} else if strings.HasPrefix(string(key), localdb.UserChecksumPrefix) {
+			fmt.Printf("Key    : %v\n", string(key))
+			fmt.Printf("Record : %v\n", hex.EncodeToString(value))
+		} else {
+			fmt.Printf("Key    : %v\n", string(key))
+			fmt.Printf("Record : unknown record %v\n",
+				hex.EncodeToString(value))
 		}
 	}
 	iter.Release()
@@ -99,32 +299,29 @@ func setAdminAction() error {
 	email := args[0]
 	admin := strings.ToLower(args[1]) == "true" || args[1] == "1"
 
-	userdb, err := leveldb.OpenFile(dbDir, &opt.Options{
-		ErrorIfMissing: true,
-	})
+	db, err := openDB()
 	if err != nil {
 		return err
 	}
-	defer userdb.Close()
+	defer db.Close()
 
-	b, err := userdb.Get([]byte(email), nil)
+	u, err := db.UserGet(email)
 	if err != nil {
-		fmt.Printf("User with email %v not found in the database\n", email)
+		return fmt.Errorf("user with email %v: %v", email, err)
 	}
 
-	u, err := localdb.DecodeUser(b)
-	if err != nil {
+	diff := fmt.Sprintf("admin: %v -> %v", u.Admin, admin)
+	u.Admin = admin
+
+	if err = confirmChange(email, diff); err != nil {
 		return err
 	}
 
-	u.Admin = admin
-
-	b, err = localdb.EncodeUser(*u)
-	if err != nil {
+	if err = db.UserUpdate(*u); err != nil {
 		return err
 	}
 
-	if err = userdb.Put([]byte(email), b, nil); err != nil {
+	if err = audit(db, "setadmin", email, diff); err != nil {
 		return err
 	}
 
@@ -137,6 +334,17 @@ func setAdminAction() error {
 	return nil
 }
 
+const (
+	// manualPaywallID is the paywall ID of proposal credits that are
+	// granted with politeiawww_dbutil.  Proposal paywall IDs start at 1 so
+	// it never matches a real paywall.
+	manualPaywallID = 0
+
+	// manualCreditTxID is the transaction ID of proposal credits that are
+	// granted with politeiawww_dbutil.
+	manualCreditTxID = database.ManualCreditTxID
+)
+
 func addCreditsAction() error {
 	// Handle cli args.
 	args := flag.Args()
@@ -147,25 +355,19 @@ func addCreditsAction() error {
 
 	email := args[0]
 	quantity, err := strconv.Atoi(args[1])
-	if err != nil {
-		return fmt.Errorf("quantity must parse to an int")
+	if err != nil || quantity <= 0 {
+		return fmt.Errorf("quantity must parse to a positive int")
 	}
 
 	// Open connection to user db.
-	db, err := leveldb.OpenFile(dbDir, &opt.Options{
-		ErrorIfMissing: true,
-	})
+	db, err := openDB()
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
 	// Fetch user from db.
-	u, err := db.Get([]byte(email), nil)
-	if err != nil {
-		return err
-	}
-	user, err := localdb.DecodeUser(u)
+	user, err := db.UserGet(email)
 	if err != nil {
 		return err
 	}
@@ -175,20 +377,27 @@ func addCreditsAction() error {
 	timestamp := time.Now().Unix()
 	for i := 0; i < quantity; i++ {
 		c[i] = database.ProposalCredit{
-			PaywallID:     0,
-			Price:         0,
+			PaywallID:     manualPaywallID,
+			Price:         *creditPrice,
 			DatePurchased: timestamp,
-			TxID:          "created_by_dbutil",
+			TxID:          manualCreditTxID,
 		}
 	}
 	user.UnspentProposalCredits = append(user.UnspentProposalCredits, c...)
 
+	diff := fmt.Sprintf("unspent proposal credits: %v -> %v at %v atoms",
+		len(user.UnspentProposalCredits)-quantity,
+		len(user.UnspentProposalCredits), *creditPrice)
+	if err = confirmChange(email, diff); err != nil {
+		return err
+	}
+
 	// Write user record to db.
-	u, err = localdb.EncodeUser(*user)
-	if err != nil {
+	if err = db.UserUpdate(*user); err != nil {
 		return err
 	}
-	if err = db.Put([]byte(email), u, nil); err != nil {
+
+	if err = audit(db, "addcredits", email, diff); err != nil {
 		return err
 	}
 
@@ -196,8 +405,596 @@ func addCreditsAction() error {
 	return nil
 }
 
+// tempPasswordSize is the number of random bytes in a temporary password.
+const tempPasswordSize = 12
+
+func resetPasswordAction() error {
+	args := flag.Args()
+	if len(args) < 1 || len(args) > 2 {
+		flag.Usage()
+		return nil
+	}
+	email := args[0]
+
+	// Use the supplied bcrypt hash or generate a temporary password.
+	var (
+		password       string
+		hashedPassword []byte
+	)
+	if len(args) == 2 {
+		hashedPassword = []byte(args[1])
+		if _, err := bcrypt.Cost(hashedPassword); err != nil {
+			return fmt.Errorf("invalid password hash: %v", err)
+		}
+	} else {
+		b := make([]byte, tempPasswordSize)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		password = hex.EncodeToString(b)
+		var err error
+		hashedPassword, err = bcrypt.GenerateFromPassword([]byte(password),
+			bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	u, err := db.UserGet(email)
+	if err != nil {
+		return fmt.Errorf("user with email %v: %v", email, err)
+	}
+
+	// Set the new password and unlock the account.
+	u.HashedPassword = hashedPassword
+	u.ResetPasswordVerificationToken = nil
+	u.ResetPasswordVerificationExpiry = 0
+	database.ResetFailedLogins(u)
+
+	diff := "password reset, reset token and failed login attempts cleared"
+	if err = confirmChange(email, diff); err != nil {
+		return err
+	}
+
+	if err = db.UserUpdate(*u); err != nil {
+		return err
+	}
+
+	// Log out existing sessions, they were authenticated with the old
+	// password.
+	if err = db.SessionsDeleteByUserID(u.ID); err != nil {
+		return err
+	}
+
+	if err = audit(db, "resetpassword", email, diff); err != nil {
+		return err
+	}
+
+	if password != "" {
+		fmt.Printf("Temporary password for %v: %v\n", email, password)
+	} else {
+		fmt.Printf("Password hash for %v set\n", email)
+	}
+	return nil
+}
+
+func clearPaywallAction() error {
+	args := flag.Args()
+	if len(args) != 1 {
+		flag.Usage()
+		return nil
+	}
+	email := args[0]
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	u, err := db.UserGet(email)
+	if err != nil {
+		return fmt.Errorf("user with email %v: %v", email, err)
+	}
+	if u.NewUserPaywallTx != "" {
+		return fmt.Errorf("user with email %v has already paid: %v", email,
+			u.NewUserPaywallTx)
+	}
+
+	// Mark the paywall as paid and stop polling the address, the same way
+	// the admin clear paywall action does.
+	diff := fmt.Sprintf("paywall address %v cleared",
+		u.NewUserPaywallAddress)
+	u.NewUserPaywallAddress = ""
+	u.NewUserPaywallAmount = 0
+	u.NewUserPaywallTx = "cleared_by_dbutil"
+	u.NewUserPaywallTxNotBefore = 0
+	u.NewUserPaywallPollExpiry = 0
+
+	if err = confirmChange(email, diff); err != nil {
+		return err
+	}
+
+	if err = db.UserUpdate(*u); err != nil {
+		return err
+	}
+
+	if err = audit(db, "clearpaywall", email, diff); err != nil {
+		return err
+	}
+
+	fmt.Printf("Registration paywall of %v cleared\n", email)
+	return nil
+}
+
+// fsckAction verifies every record.  The database is accessed directly
+// because opening it through localdb writes a version record if there is
+// none, which would hide a missing version.
+func fsckAction() error {
+	userdb, err := openRawDB()
+	if err != nil {
+		return err
+	}
+	defer userdb.Close()
+
+	var records, failures int
+	version, v, err := describeVersion(userdb)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version == "missing":
+		failures++
+		fmt.Printf("Key    : %v\n", localdb.UserVersionKey)
+		fmt.Printf("Error  : missing\n")
+	case v != nil && v.Version > localdb.UserVersion:
+		failures++
+		fmt.Printf("Key    : %v\n", localdb.UserVersionKey)
+		fmt.Printf("Error  : version %v, expected at most %v\n",
+			v.Version, localdb.UserVersion)
+	}
+
+	prog := newProgress("fsck", 0, 0)
+	err = localdb.VerifyRecords(userdb, func(key string, err error) {
+		records++
+		prog.add(1)
+		if err == nil {
+			return
+		}
+		failures++
+		prog.fail()
+		fmt.Printf("Key    : %v\n", key)
+		fmt.Printf("Error  : %v\n", err)
+	})
+	if err != nil {
+		return err
+	}
+	prog.finish()
+
+	fmt.Printf("%v records checked, %v failures\n", records, failures)
+	if failures > 0 {
+		return fmt.Errorf("database integrity check failed")
+	}
+
+	return nil
+}
+
+func emailQueueAction() error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	emails := make([]*database.QueuedEmail, 0)
+	err = db.AllQueuedEmails(func(e *database.QueuedEmail) {
+		emails = append(emails, e)
+	})
+	if err != nil {
+		return err
+	}
+
+	printResult(emails, func() {
+		for _, e := range emails {
+			status := "pending"
+			if e.IsFailed() {
+				status = "failed"
+			}
+
+			fmt.Printf("%v\n", strings.Repeat("=", 80))
+			fmt.Printf("ID       : %v\n", e.ID)
+			fmt.Printf("Status   : %v\n", status)
+			fmt.Printf("To       : %v\n", strings.Join(e.To, ", "))
+			fmt.Printf("BCC      : %v\n", strings.Join(e.BCC, ", "))
+			fmt.Printf("Subject  : %v\n", e.Subject)
+			fmt.Printf("Queued   : %v\n", time.Unix(e.CreatedAt, 0))
+			fmt.Printf("Attempts : %v\n", e.Attempts)
+			if e.LastError != "" {
+				fmt.Printf("Error    : %v\n", e.LastError)
+			}
+		}
+		fmt.Printf("%v queued emails\n", len(emails))
+	})
+	return nil
+}
+
+func flushEmailsAction() error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// If an id is provided, only remove that email.
+	args := flag.Args()
+	if len(args) == 1 {
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("id must parse to a uint64")
+		}
+
+		diff := fmt.Sprintf("removed email %v", id)
+		if err := confirmChange("flushemails", diff); err != nil {
+			return err
+		}
+
+		if err := db.EmailDelete(id); err != nil {
+			return fmt.Errorf("email %v: %v", id, err)
+		}
+
+		if err = audit(db, "flushemails", "", diff); err != nil {
+			return err
+		}
+
+		fmt.Printf("Email %v removed from the queue\n", id)
+		return nil
+	}
+
+	var ids []uint64
+	err = db.AllQueuedEmails(func(e *database.QueuedEmail) {
+		ids = append(ids, e.ID)
+	})
+	if err != nil {
+		return err
+	}
+	diff := fmt.Sprintf("removed %v emails", len(ids))
+	if err = confirmChange("flushemails", diff); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := db.EmailDelete(id); err != nil {
+			return fmt.Errorf("email %v: %v", id, err)
+		}
+	}
+
+	if err = audit(db, "flushemails", "", diff); err != nil {
+		return err
+	}
+
+	fmt.Printf("%v emails removed from the queue\n", len(ids))
+	return nil
+}
+
+func userHistoryAction() error {
+	args := flag.Args()
+	if len(args) != 1 {
+		flag.Usage()
+		return nil
+	}
+	email := args[0]
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	history, err := db.UserHistory(email)
+	if err != nil {
+		return fmt.Errorf("user with email %v: %v", email, err)
+	}
+
+	if *jsonOutput {
+		versions, err := historyValues(history, !*unredacted)
+		if err != nil {
+			return err
+		}
+		result = versions
+		return nil
+	}
+
+	for _, h := range history {
+		fmt.Printf("%v\n", strings.Repeat("=", 80))
+		fmt.Printf("Version  : %v\n", h.Version)
+		fmt.Printf("Replaced : %v\n", time.Unix(h.Timestamp, 0))
+		fmt.Printf("Record   : %v", spew.Sdump(h.User))
+	}
+
+	fmt.Printf("%v previous versions\n", len(history))
+	return nil
+}
+
+// parseDate parses a YYYY-MM-DD date into a unix timestamp.
+func parseDate(s string) (int64, error) {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid date %v: must be YYYY-MM-DD", s)
+	}
+	return t.Unix(), nil
+}
+
+func auditLogAction() error {
+	// Handle cli args.
+	var since, until int64
+	args := flag.Args()
+	if len(args) > 2 {
+		flag.Usage()
+		return nil
+	}
+	if len(args) > 0 {
+		var err error
+		since, err = parseDate(args[0])
+		if err != nil {
+			return err
+		}
+	}
+	if len(args) > 1 {
+		var err error
+		until, err = parseDate(args[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	entries := make([]*database.AuditEntry, 0)
+	err = db.AuditLog(since, until, func(a *database.AuditEntry) {
+		entries = append(entries, a)
+	})
+	if err != nil {
+		return err
+	}
+
+	printResult(entries, func() {
+		for _, a := range entries {
+			fmt.Printf("%v\n", strings.Repeat("=", 80))
+			fmt.Printf("ID     : %v\n", a.ID)
+			fmt.Printf("Time   : %v\n", time.Unix(a.Timestamp, 0))
+			fmt.Printf("Actor  : %v\n", a.Actor)
+			fmt.Printf("Action : %v\n", a.Action)
+			if a.Target != "" {
+				fmt.Printf("Target : %v\n", a.Target)
+			}
+			fmt.Printf("Diff   : %v\n", a.Diff)
+		}
+		fmt.Printf("%v audit log entries\n", len(entries))
+	})
+	return nil
+}
+
+// migrateBatchSize is the number of records that are written to the
+// destination database at a time during a migration.
+const migrateBatchSize = 1000
+
+func migrateAction(net string) error {
+	args := flag.Args()
+	if len(args) != 1 {
+		flag.Usage()
+		return nil
+	}
+	dstDir := filepath.Join(args[0], net, localdb.UserdbPath)
+	same, err := sameDir(dbDir, dstDir)
+	if err != nil {
+		return err
+	}
+	if same {
+		return fmt.Errorf("source and destination are the same database")
+	}
+
+	cp, err := loadCheckpoint("migrate")
+	if err != nil {
+		return err
+	}
+	switch {
+	case cp != nil && !*resume:
+		return fmt.Errorf("an interrupted migration to %v was found; "+
+			"resume it with --resume or delete %v",
+			strings.Join(cp.Args, " "),
+			checkpointPath("migrate"))
+	case cp == nil && *resume:
+		return fmt.Errorf("there is no interrupted migration to resume")
+	case cp != nil && !cp.sameArgs(args):
+		return fmt.Errorf("the interrupted migration was to %v",
+			strings.Join(cp.Args, " "))
+	}
+
+	// The source is accessed directly so that nothing is written to it,
+	// not even by --dryrun.
+	src, err := openRawDB()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	fresh := cp == nil
+	if fresh {
+		// Verify the source records before anything is written so
+		// that a corrupt database isn't propagated.
+		records, err := migrateVerifySource(src)
+		if err != nil {
+			return err
+		}
+		err = confirmChange("migrate", fmt.Sprintf("copy %v records to %v",
+			records, dstDir))
+		if err != nil {
+			return err
+		}
+		cp = &checkpoint{
+			Action: "migrate",
+			Args:   args,
+			Total:  records,
+		}
+	} else {
+		err = confirmChange("migrate", fmt.Sprintf("resume copying "+
+			"records to %v after %v/%v records", dstDir, cp.Done,
+			cp.Total))
+		if err != nil {
+			return err
+		}
+	}
+
+	// The checkpoint is saved before the destination is created so that
+	// a migration that is interrupted at any point can be resumed.  A new
+	// migration must not overwrite an existing database.
+	if fresh {
+		if _, err := os.Stat(dstDir); err == nil {
+			return fmt.Errorf("destination %v already exists", dstDir)
+		}
+	}
+	if err := cp.save(); err != nil {
+		return err
+	}
+	dst, err := leveldb.OpenFile(dstDir, nil)
+	if err != nil {
+		return fmt.Errorf("destination %v: %v", dstDir, err)
+	}
+	defer dst.Close()
+
+	// Copy the records.  The checkpoint is saved after every batch that
+	// was written so that the copy can be resumed after an interruption.
+	prog := newProgress("migrate", cp.Total, cp.Done)
+	batch := new(leveldb.Batch)
+	var lastKey []byte
+	flush := func() error {
+		if batch.Len() == 0 {
+			return nil
+		}
+		if err := dst.Write(batch, nil); err != nil {
+			return err
+		}
+		cp.Cursor = lastKey
+		cp.Done += batch.Len()
+		prog.add(batch.Len())
+		batch.Reset()
+		return cp.save()
+	}
+	iter := src.NewIterator(cp.resumeRange(), nil)
+	for iter.Next() {
+		lastKey = append([]byte{}, iter.Key()...)
+		batch.Put(lastKey, append([]byte{}, iter.Value()...))
+		if batch.Len() < migrateBatchSize {
+			continue
+		}
+		if err := flush(); err != nil {
+			iter.Release()
+			return err
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	prog.finish()
+	fmt.Printf("Migrated %v/%v records\n", cp.Done, cp.Total)
+
+	// Verify that the destination matches the source.
+	prog = newProgress("verify", cp.Done, 0)
+	iter = src.NewIterator(nil, nil)
+	for iter.Next() {
+		value, err := dst.Get(iter.Key(), nil)
+		if err != nil || !bytes.Equal(value, iter.Value()) {
+			iter.Release()
+			return fmt.Errorf("record %v was not migrated correctly",
+				string(iter.Key()))
+		}
+		prog.add(1)
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	prog.finish()
+
+	if err := cp.remove(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Database migrated to %v\n", dstDir)
+	return nil
+}
+
+// sameDir returns whether both paths refer to the same existing directory,
+// regardless of how the paths are spelled or of symlinks.
+func sameDir(a, b string) (bool, error) {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	fb, err := os.Stat(b)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return os.SameFile(fa, fb), nil
+}
+
+// migrateVerifySource verifies every record of the source database and
+// returns the number of records.
+func migrateVerifySource(src *leveldb.DB) (int, error) {
+	var records, failures int
+	prog := newProgress("verify", 0, 0)
+	err := localdb.VerifyRecords(src, func(key string, err error) {
+		records++
+		prog.add(1)
+		if err != nil {
+			failures++
+			prog.fail()
+			fmt.Printf("Key    : %v\n", key)
+			fmt.Printf("Error  : %v\n", err)
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	prog.finish()
+	if failures > 0 {
+		return 0, fmt.Errorf("%v of %v records failed verification; run "+
+			"--fsck and fix the source database first", failures, records)
+	}
+
+	return records, nil
+}
+
 func _main() error {
+	flag.Var(&sets, "set", "Set a user field with --edituser, e.g. --set admin=true. May be repeated.")
 	flag.Parse()
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	if err := parseAndSetDebugLevels(*debugLevel); err != nil {
+		return err
+	}
+	if *metricsListen != "" {
+		if err := startMetricsServer(*metricsListen); err != nil {
+			return err
+		}
+	}
 
 	var net string
 	if *testnet {
@@ -207,27 +1004,180 @@ func _main() error {
 	}
 
 	dbDir = filepath.Join(*dataDir, net, localdb.UserdbPath)
-	fmt.Printf("Database: %v\n", dbDir)
+	if flag.Arg(0) == "help" && selectedCommand() == "" {
+		return helpAction(flag.Args()[1:])
+	}
+	if *jsonOutput {
+		return runJSON(net)
+	}
+	if *format != "" || *exportUserFlag {
+		// Keep stdout machine readable.
+		fmt.Fprintf(os.Stderr, "Database: %v\n", dbDir)
+	} else {
+		fmt.Printf("Database: %v\n", dbDir)
+	}
 
+	if err := checkDBDir(); err != nil {
+		return err
+	}
+
+	if *shell {
+		return shellAction(net)
+	}
+
+	err := runAction(net)
+	if err == errNoAction {
+		flag.Usage()
+		return nil
+	}
+	return err
+}
+
+// checkDBDir returns an error if the database directory does not exist.
+func checkDBDir() error {
 	if _, err := os.Stat(dbDir); os.IsNotExist(err) {
 		return fmt.Errorf("database directory does not exist: %v",
 			dbDir)
 	}
+	return nil
+}
+
+// errNoAction is returned by runAction when no action flag is set.
+var errNoAction = errors.New("no action specified")
+
+// runAction runs the action that is selected by the command line flags.
+func runAction(net string) error {
+	err := runSelectedAction(net)
+	if err == errDryRun {
+		fmt.Printf("Dry run, no changes were made\n")
+		return nil
+	}
+	return err
+}
 
+func runSelectedAction(net string) error {
 	if *addCredits {
 		if err := addCreditsAction(); err != nil {
 			return err
 		}
+	} else if *auditLog {
+		if err := auditLogAction(); err != nil {
+			return err
+		}
+	} else if *checkDuplicates {
+		if err := checkDupesAction(); err != nil {
+			return err
+		}
+	} else if *clearPaywall {
+		if err := clearPaywallAction(); err != nil {
+			return err
+		}
+	} else if *deactivateUser {
+		if err := deactivateUserAction(); err != nil {
+			return err
+		}
+	} else if *disable2FA {
+		if err := disable2FAAction(); err != nil {
+			return err
+		}
 	} else if *dumpDb {
 		if err := dumpAction(); err != nil {
 			return err
 		}
+	} else if *editUser {
+		if err := editUserAction(); err != nil {
+			return err
+		}
+	} else if *emailQueue {
+		if err := emailQueueAction(); err != nil {
+			return err
+		}
+	} else if *expireTokens {
+		if err := expireTokensAction(); err != nil {
+			return err
+		}
+	} else if *exportUserFlag {
+		if err := exportUserAction(); err != nil {
+			return err
+		}
+	} else if *flushEmail {
+		if err := flushEmailsAction(); err != nil {
+			return err
+		}
+	} else if *fsck {
+		if err := fsckAction(); err != nil {
+			return err
+		}
+	} else if *identities {
+		if err := identitiesAction(); err != nil {
+			return err
+		}
+	} else if *importDb {
+		if err := importAction(); err != nil {
+			return err
+		}
+	} else if *listInvites {
+		if err := listInvitesAction(); err != nil {
+			return err
+		}
+	} else if *migrate {
+		if err := migrateAction(net); err != nil {
+			return err
+		}
+	} else if *reactivateUser {
+		if err := reactivateUserAction(); err != nil {
+			return err
+		}
+	} else if *reconcilePaywalls {
+		if err := reconcilePaywallsAction(); err != nil {
+			return err
+		}
+	} else if *resetPass {
+		if err := resetPasswordAction(); err != nil {
+			return err
+		}
+	} else if *searchUsers {
+		if err := searchUsersAction(); err != nil {
+			return err
+		}
+	} else if *sendInvite {
+		if err := sendInviteAction(); err != nil {
+			return err
+		}
 	} else if *setAdmin {
 		if err := setAdminAction(); err != nil {
 			return err
 		}
+	} else if *setEmail {
+		if err := setEmailAction(); err != nil {
+			return err
+		}
+	} else if *setVersion {
+		if err := setVersionAction(); err != nil {
+			return err
+		}
+	} else if *setUsername {
+		if err := setUsernameAction(); err != nil {
+			return err
+		}
+	} else if *stats {
+		if err := statsAction(); err != nil {
+			return err
+		}
+	} else if *stubUsers {
+		if err := stubUsersAction(); err != nil {
+			return err
+		}
+	} else if *userHist {
+		if err := userHistoryAction(); err != nil {
+			return err
+		}
+	} else if *verifyDB {
+		if err := verifyDBAction(); err != nil {
+			return err
+		}
 	} else {
-		flag.Usage()
+		return errNoAction
 	}
 
 	return nil
@@ -236,7 +1186,9 @@ func _main() error {
 func main() {
 	err := _main()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
+		if err != errReported {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
 		os.Exit(1)
 	}
 }
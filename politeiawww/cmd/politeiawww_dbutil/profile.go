@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/decred/politeia/politeiawww/sharedconfig"
+)
+
+const defaultProfileFilename = "dbutil.conf"
+
+var defaultProfileFile = filepath.Join(sharedconfig.DefaultHomeDir,
+	defaultProfileFilename)
+
+// defaultValues holds the flag values set by the environment and the
+// selected profile.  They replace the flag defaults so that the shell keeps
+// them between commands.
+var defaultValues = make(map[string]string)
+
+// cockroachOptions are the connection options of the CockroachDB backend,
+// which this version of politeiawww doesn't support.
+var cockroachOptions = map[string]bool{
+	"dbhost":     true,
+	"dbrootcert": true,
+	"dbcert":     true,
+	"dbkey":      true,
+}
+
+// readProfile returns the options of the named profile in the config file.
+// The file uses the same ini format as politeiawww.conf, with one section
+// per profile:
+//
+//	[testnet-leveldb]
+//	testnet = true
+//	datadir = ~/.politeiawww/data
+func readProfile(path, name string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		section string
+		found   bool
+		lineNum int
+	)
+	options := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, fmt.Errorf("%v:%v: invalid section %v",
+					path, lineNum, line)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			found = found || section == name
+			continue
+		}
+		if section != name {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%v:%v: invalid option %v: must be "+
+				"name = value", path, lineNum, line)
+		}
+		options[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("profile %v not found in %v", name, path)
+	}
+
+	return options, nil
+}
+
+// cleanAndExpandPath expands environment variables and leading ~ in the
+// passed path, cleans the result, and returns it.
+func cleanAndExpandPath(path string) string {
+	// Expand initial ~ to OS specific home directory.
+	if strings.HasPrefix(path, "~") {
+		homeDir := filepath.Dir(sharedconfig.DefaultHomeDir)
+		path = strings.Replace(path, "~", homeDir, 1)
+	}
+
+	return filepath.Clean(os.ExpandEnv(path))
+}
+
+// applyProfile sets the flags from the profile selected with --profile.
+// Flags in explicit, which were given on the command line or in the
+// environment, take precedence over the profile.
+func applyProfile(explicit map[string]bool) error {
+	if *profile == "" {
+		return nil
+	}
+
+	options, err := readProfile(*profileFile, *profile)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range options {
+		switch {
+		case cockroachOptions[name]:
+			return fmt.Errorf("profile %v: %v: the cockroachdb backend "+
+				"is not supported", *profile, name)
+		case name == "profile" || name == "configfile" || name == "set":
+			return fmt.Errorf("profile %v: %v can't be set in a "+
+				"profile", *profile, name)
+		case flag.Lookup(name) == nil:
+			return fmt.Errorf("profile %v: unknown option %v",
+				*profile, name)
+		}
+
+		if name == "datadir" {
+			value = cleanAndExpandPath(value)
+		}
+
+		// Values from the environment are already in defaultValues.
+		if _, ok := defaultValues[name]; !ok {
+			defaultValues[name] = value
+		}
+		if explicit[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("profile %v: %v: %v", *profile, name, err)
+		}
+	}
+
+	return nil
+}
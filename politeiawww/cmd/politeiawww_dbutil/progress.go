@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// progressInterval is the minimum time between two progress lines.
+const progressInterval = time.Second
+
+// progress prints the throughput and the estimated time left of a long
+// running command.  It writes to stderr so that stdout stays machine
+// readable.  The progress of the running command is also exported with
+// --metricslisten.
+type progress struct {
+	name     string
+	total    int // Expected number of items, 0 if unknown
+	done     int
+	resumed  int // Items done before the command was resumed
+	failures int // Items that failed a check
+	start    time.Time
+	printed  time.Time
+}
+
+func newProgress(name string, total, resumed int) *progress {
+	now := time.Now()
+	p := &progress{
+		name:    name,
+		total:   total,
+		done:    resumed,
+		resumed: resumed,
+		start:   now,
+		printed: now,
+	}
+	registerProgress(p)
+	return p
+}
+
+// add records n more items as done and prints a progress line if the last
+// one is older than progressInterval.
+func (p *progress) add(n int) {
+	metricsMtx.Lock()
+	p.done += n
+	metricsMtx.Unlock()
+
+	if time.Since(p.printed) < progressInterval {
+		return
+	}
+	p.print()
+}
+
+// fail records an item that failed a check.
+func (p *progress) fail() {
+	metricsMtx.Lock()
+	p.failures++
+	metricsMtx.Unlock()
+}
+
+// finish prints the final progress line unless the command completed
+// before the first one was due.
+func (p *progress) finish() {
+	if time.Since(p.start) < progressInterval {
+		return
+	}
+	p.print()
+}
+
+// rate returns the number of items done per second since the start.
+func (p *progress) rate() float64 {
+	elapsed := time.Since(p.start)
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(p.done-p.resumed) / elapsed.Seconds()
+}
+
+// eta returns the estimated time left and false if it is unknown.
+func (p *progress) eta() (time.Duration, bool) {
+	rate := p.rate()
+	if p.total == 0 || rate <= 0 || p.done > p.total {
+		return 0, false
+	}
+	return time.Duration(float64(p.total-p.done)/rate) * time.Second, true
+}
+
+func (p *progress) print() {
+	p.printed = time.Now()
+	rate := p.rate()
+
+	if p.total == 0 {
+		fmt.Fprintf(os.Stderr, "%v: %v records, %.0f/s\n", p.name, p.done,
+			rate)
+		return
+	}
+
+	eta := "unknown"
+	if left, ok := p.eta(); ok {
+		eta = left.Round(time.Second).String()
+	}
+	fmt.Fprintf(os.Stderr, "%v: %v/%v records (%v%%), %.0f/s, ETA %v\n",
+		p.name, p.done, p.total, p.done*100/p.total, rate, eta)
+}
+
+// checkpoint is persisted by long running commands so that an interrupted
+// run can be resumed with --resume.
+type checkpoint struct {
+	Action string   `json:"action"`
+	Args   []string `json:"args"`   // Command parameters of the run
+	Cursor []byte   `json:"cursor"` // Last key that was processed
+	Done   int      `json:"done"`   // Number of records processed
+	Total  int      `json:"total"`  // Number of records when the run started
+
+	// State is the action specific state of the run.
+	State json.RawMessage `json:"state,omitempty"`
+}
+
+// checkpointPath returns the path of the checkpoint of the action.  It is
+// kept next to the database so that it is tied to it.
+func checkpointPath(action string) string {
+	return filepath.Join(filepath.Dir(dbDir), "dbutil_"+action+".checkpoint")
+}
+
+// loadCheckpoint returns the checkpoint of an interrupted run of the action
+// or nil if there is none.
+func loadCheckpoint(action string) (*checkpoint, error) {
+	b, err := ioutil.ReadFile(checkpointPath(action))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var c checkpoint
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %v: %v",
+			checkpointPath(action), err)
+	}
+	return &c, nil
+}
+
+// save writes the checkpoint.  The file is replaced atomically so that an
+// interruption never leaves a partial checkpoint behind.
+func (c *checkpoint) save() error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	path := checkpointPath(c.Action)
+	if err := ioutil.WriteFile(path+".tmp", b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// remove deletes the checkpoint once the run has completed.
+func (c *checkpoint) remove() error {
+	err := os.Remove(checkpointPath(c.Action))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// resumeRange returns the range of the keys after the cursor, or nil to
+// start at the first key.
+func (c *checkpoint) resumeRange() *util.Range {
+	if c.Cursor == nil {
+		return nil
+	}
+	// The key with a zero byte appended is the smallest key after the
+	// cursor.
+	return &util.Range{Start: append(append([]byte{}, c.Cursor...), 0)}
+}
+
+// sameArgs returns whether the checkpoint was created with the given
+// command parameters.
+func (c *checkpoint) sameArgs(args []string) bool {
+	if len(c.Args) != len(args) {
+		return false
+	}
+	for i := range args {
+		if c.Args[i] != args[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/decred/politeia/politeiawww/database"
+	"github.com/decred/politeia/politeiawww/paywall"
+)
+
+// reconcileRequestGap is the time between two payment lookups so that the
+// API isn't flooded.
+const reconcileRequestGap = 250 * time.Millisecond
+
+// reconcileUserPaywall marks the registration paywall of the user as paid if
+// a payment was made to it.  It returns whether a payment was found.
+func reconcileUserPaywall(db database.Database, pp paywall.PaymentProcessor, u *database.User) (bool, error) {
+	if u.NewUserPaywallAddress == "" || u.NewUserPaywallTx != "" {
+		return false, nil
+	}
+
+	payment, err := pp.FetchPayment(paywall.UserPaywall(u), *minConfirmations)
+	time.Sleep(reconcileRequestGap)
+	if err != nil {
+		return false, fmt.Errorf("address %v: %v",
+			u.NewUserPaywallAddress, err)
+	}
+	if payment == nil {
+		return false, nil
+	}
+
+	diff := fmt.Sprintf("registration paywall %v paid by tx %v",
+		u.NewUserPaywallAddress, payment.TxID)
+	if err := confirmChange(u.Email, diff); err != nil {
+		return true, err
+	}
+
+	paywall.MarkUserPaid(u, payment.TxID, time.Now().Unix())
+	if err := db.UserUpdate(*u); err != nil {
+		return true, err
+	}
+
+	if err := audit(db, "reconcilepaywalls", u.Email, diff); err != nil {
+		return true, err
+	}
+
+	fmt.Printf("%v: %v\n", u.Email, diff)
+	return true, nil
+}
+
+// reconcileProposalPaywall grants the proposal credits for a payment made
+// to the given proposal paywall of the user.  It returns whether a payment
+// was found.
+func reconcileProposalPaywall(db database.Database, pp paywall.PaymentProcessor, u *database.User, i int) (bool, error) {
+	p := &u.ProposalPaywalls[i]
+	if p.TxID != "" || p.CreditPrice == 0 {
+		return false, nil
+	}
+
+	payment, err := pp.FetchPayment(paywall.ProposalPaywall(p),
+		*minConfirmations)
+	time.Sleep(reconcileRequestGap)
+	if err != nil {
+		return false, fmt.Errorf("address %v: %v", p.Address, err)
+	}
+	if payment == nil {
+		return false, nil
+	}
+
+	diff := fmt.Sprintf("proposal paywall %v paid by tx %v, %v proposal "+
+		"credits granted", p.ID, payment.TxID,
+		payment.Amount/p.CreditPrice)
+	if err := confirmChange(u.Email, diff); err != nil {
+		return true, err
+	}
+
+	// politeiawww uses the same operation ID so that credits are never
+	// granted twice for the same payment.
+	paywall.GrantProposalCredits(u, p, *payment, time.Now().Unix())
+	err = db.UserUpdateOnce(paywall.CreditsOperationID(payment.TxID), *u)
+	if err == database.ErrDuplicateOperation {
+		fmt.Printf("%v: proposal credits for tx %v were already granted\n",
+			u.Email, payment.TxID)
+		return false, nil
+	} else if err != nil {
+		return true, err
+	}
+
+	if err := audit(db, "reconcilepaywalls", u.Email, diff); err != nil {
+		return true, err
+	}
+
+	fmt.Printf("%v: %v\n", u.Email, diff)
+	return true, nil
+}
+
+func reconcilePaywallsAction() error {
+	args := flag.Args()
+	if len(args) != 1 {
+		flag.Usage()
+		return nil
+	}
+	pp := &paywall.Dcrdata{APIURL: args[0]}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var users []*database.User
+	err = db.AllUsers(func(u *database.User) {
+		users = append(users, u)
+	})
+	if err != nil {
+		return err
+	}
+
+	var found, failed int
+	for _, u := range users {
+		paid, err := reconcileUserPaywall(db, pp, u)
+		if paid {
+			found++
+		}
+		if err != nil && err != errDryRun {
+			fmt.Printf("%v: %v\n", u.Email, err)
+			failed++
+		}
+
+		for i := range u.ProposalPaywalls {
+			paid, err := reconcileProposalPaywall(db, pp, u, i)
+			if paid {
+				found++
+			}
+			if err != nil && err != errDryRun {
+				fmt.Printf("%v: %v\n", u.Email, err)
+				failed++
+			}
+		}
+	}
+
+	fmt.Printf("%v missed payments found\n", found)
+	if failed > 0 {
+		return fmt.Errorf("%v paywalls could not be reconciled", failed)
+	}
+	if *dryRun {
+		return errDryRun
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/decred/politeia/politeiawww/database"
+	"github.com/decred/politeia/politeiawww/database/localdb"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// describeVersion returns a description of the stored version record and
+// whether it is valid.
+func describeVersion(userdb *leveldb.DB) (string, *localdb.Version, error) {
+	b, err := userdb.Get([]byte(localdb.UserVersionKey), nil)
+	switch err {
+	case nil:
+	case leveldb.ErrNotFound:
+		return "missing", nil, nil
+	default:
+		return "", nil, err
+	}
+
+	v, err := localdb.DecodeVersion(b)
+	if err != nil {
+		return fmt.Sprintf("corrupt (%v)", err), nil, nil
+	}
+	return strconv.FormatUint(uint64(v.Version), 10), v, nil
+}
+
+// writeVersion verifies that every record decodes with this version of
+// politeiawww and rewrites the version record.  It returns the change that
+// was made, or an empty string if the database is already at the version.
+// The database is accessed directly because opening it through localdb
+// writes a version record if there is none and fails with ErrWrongVersion if
+// it was written by a newer version.
+func writeVersion(version uint32) (string, error) {
+	userdb, err := openRawDB()
+	if err != nil {
+		return "", err
+	}
+	defer userdb.Close()
+
+	current, stored, err := describeVersion(userdb)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("Version: %v\n", current)
+
+	// The version record itself is what is being repaired, so its own
+	// failure is not counted.  Missing checksums are added when a version
+	// that requires them is set.
+	var records, failures int
+	prog := newProgress("setversion", 0, 0)
+	err = localdb.VerifyRecords(userdb, func(key string, err error) {
+		records++
+		prog.add(1)
+		if err == nil || key == localdb.UserVersionKey ||
+			err == database.ErrChecksumMissing {
+			return
+		}
+		failures++
+		prog.fail()
+		fmt.Printf("Key    : %v\n", key)
+		fmt.Printf("Error  : %v\n", err)
+	})
+	if err != nil {
+		return "", err
+	}
+	prog.finish()
+	if failures > 0 {
+		return "", fmt.Errorf("%v of %v records failed verification; "+
+			"run --fsck and fix the database first", failures, records)
+	}
+
+	if stored != nil && stored.Version == version {
+		return "", nil
+	}
+
+	diff := fmt.Sprintf("version: %v -> %v", current, version)
+	if err = confirmChange("setversion", diff); err != nil {
+		return "", err
+	}
+
+	return diff, localdb.SetVersion(userdb, version)
+}
+
+// setVersionAction rewrites the version record, e.g. when it is missing or
+// corrupt or when the database was written by a newer version of
+// politeiawww, and records the change in the audit log.
+func setVersionAction() error {
+	args := flag.Args()
+	if len(args) > 1 {
+		flag.Usage()
+		return nil
+	}
+
+	version := localdb.UserVersion
+	if len(args) == 1 {
+		v, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid version %v", args[0])
+		}
+		version = uint32(v)
+	}
+	if version == 0 || version > localdb.UserVersion {
+		return fmt.Errorf("unsupported version %v; this version of "+
+			"politeiawww supports versions 1 to %v", version,
+			localdb.UserVersion)
+	}
+
+	diff, err := writeVersion(version)
+	if err != nil {
+		return err
+	}
+	if diff == "" {
+		fmt.Printf("Database is already at version %v\n", version)
+		return nil
+	}
+
+	// The audit log is written through localdb, which can only be opened
+	// once the raw handle is closed.
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err = audit(db, "setversion", "", diff); err != nil {
+		return err
+	}
+
+	fmt.Printf("Database version set to %v\n", version)
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/decred/politeia/politeiawww/database"
+)
+
+var (
+	// inShell is set while the interactive shell is running.
+	inShell bool
+
+	// shellDB is the database that is shared by the shell commands.  It is
+	// opened on first use.
+	shellDB database.Database
+)
+
+// shellDatabase wraps the shared shell database so that the commands can't
+// close it.
+type shellDatabase struct {
+	database.Database
+}
+
+// Close satisfies the database interface.  The shared database is closed
+// when the shell exits.
+func (shellDatabase) Close() error {
+	return nil
+}
+
+// closeShellDB closes the shared shell database if it is open.
+func closeShellDB() error {
+	if shellDB == nil {
+		return nil
+	}
+	err := shellDB.Close()
+	shellDB = nil
+	return err
+}
+
+// splitShellLine splits a line into words.  Single and double quotes group
+// words that contain spaces.
+func splitShellLine(line string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, c := range line {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// resetFlags restores every flag to its default value, or to its value in
+// the environment or the profile the shell was started with.
+func resetFlags() {
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name == "set" {
+			return
+		}
+		if v, ok := defaultValues[f.Name]; ok {
+			f.Value.Set(v)
+			return
+		}
+		f.Value.Set(f.DefValue)
+	})
+	sets = nil
+}
+
+// runShellLine runs a single shell command.  Commands are the regular
+// command line flags; the leading dashes of the first word are optional.
+func runShellLine(net string, words []string) error {
+	if !strings.HasPrefix(words[0], "-") {
+		words[0] = "--" + words[0]
+	}
+
+	resetFlags()
+	dir, tn, prof, cf := *dataDir, *testnet, *profile, *profileFile
+	ml := *metricsListen
+	if err := flag.CommandLine.Parse(words); err != nil {
+		// The flag package already printed the error.
+		return nil
+	}
+	if *dataDir != dir || *testnet != tn {
+		return fmt.Errorf("--datadir and --testnet can't be changed in " +
+			"the shell")
+	}
+	if *profile != prof || *profileFile != cf {
+		return fmt.Errorf("--profile and --configfile can't be changed " +
+			"in the shell")
+	}
+	if *metricsListen != ml {
+		return fmt.Errorf("--metricslisten can't be changed in the shell")
+	}
+	if *shell {
+		return fmt.Errorf("already in the shell")
+	}
+	if err := validateConfig(); err != nil {
+		return err
+	}
+	if err := parseAndSetDebugLevels(*debugLevel); err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		err := runJSON(net)
+		if err == errReported {
+			return nil
+		}
+		return err
+	}
+
+	return runAction(net)
+}
+
+func shellAction(net string) error {
+	inShell = true
+	defer closeShellDB()
+
+	// Flag parse errors are returned instead of exiting the shell.
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	flag.CommandLine.Usage = func() {}
+
+	fmt.Printf("Type help for a list of commands, history to list previous " +
+		"commands, !<n> to repeat one and exit to quit.\n")
+
+	var history []string
+	for {
+		fmt.Printf("dbutil> ")
+		line, err := readLine()
+		if err == io.EOF {
+			fmt.Printf("\n")
+			return nil
+		} else if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+
+		// Repeat a previous command.
+		if strings.HasPrefix(line, "!") {
+			n, err := strconv.Atoi(line[1:])
+			if err != nil || n < 1 || n > len(history) {
+				fmt.Printf("invalid history entry %v\n", line)
+				continue
+			}
+			line = history[n-1]
+			fmt.Printf("%v\n", line)
+		}
+
+		if line == "help" || strings.HasPrefix(line, "help ") {
+			if err := helpAction(strings.Fields(line)[1:]); err != nil {
+				fmt.Printf("%v\n", err)
+			}
+			continue
+		}
+
+		switch line {
+		case "":
+			continue
+		case "exit", "quit":
+			return nil
+		case "history":
+			for i, h := range history {
+				fmt.Printf("%5v  %v\n", i+1, h)
+			}
+			continue
+		}
+		history = append(history, line)
+
+		words, err := splitShellLine(line)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			continue
+		}
+		err = runShellLine(net, words)
+		if err == errNoAction {
+			fmt.Printf("unknown command; type help for a list of commands\n")
+		} else if err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}
+}
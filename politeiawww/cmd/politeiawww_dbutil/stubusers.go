@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/decred/politeia/politeiad/api/v1/identity"
+	"github.com/decred/politeia/politeiawww/database"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// stubUserPrefix is the prefix of the usernames and emails of stub
+	// users.
+	stubUserPrefix = "stubuser"
+
+	// stubUserMaxAge is how far in the past stub users may have been
+	// created.
+	stubUserMaxAge = 90 * 24 * time.Hour
+)
+
+// newStubUser returns a fake user with the given index.  All stub users
+// share the same password hash so that they can be used to log in.
+func newStubUser(index int, hashedPassword []byte) (*database.User, error) {
+	id, err := identity.New()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	created := now.Add(-time.Duration(rand.Int63n(int64(stubUserMaxAge))))
+	lastLogin := created.Add(time.Duration(rand.Int63n(int64(
+		now.Sub(created)))))
+
+	name := fmt.Sprintf("%v%v", stubUserPrefix, index)
+	u := database.User{
+		Email:          name + "@example.com",
+		Username:       name,
+		HashedPassword: hashedPassword,
+		LastLoginTime:  lastLogin.Unix(),
+		Identities: []database.Identity{{
+			Key:       id.Public.Key,
+			Activated: created.Unix(),
+		}},
+	}
+
+	if !*stubPaywall {
+		return &u, nil
+	}
+
+	// Cycle through the registration paywall states.
+	switch index % 3 {
+	case 0:
+		// Unpaid; the paywall is no longer polled.
+		u.NewUserPaywallAddress = "TsStub" + hex.EncodeToString(id.Public.Key[:8])
+		u.NewUserPaywallAmount = 10000000
+		u.NewUserPaywallTxNotBefore = created.Unix()
+		u.NewUserPaywallPollExpiry = created.Add(24 * time.Hour).Unix()
+	case 1:
+		// Paid.
+		u.NewUserPaywallAddress = "TsStub" + hex.EncodeToString(id.Public.Key[:8])
+		u.NewUserPaywallAmount = 10000000
+		u.NewUserPaywallTx = hex.EncodeToString(id.Public.Key[:])
+		u.NewUserPaywallTxNotBefore = created.Unix()
+	case 2:
+		// Cleared by an admin.
+		u.NewUserPaywallTx = "cleared_by_admin"
+	}
+
+	return &u, nil
+}
+
+func stubUsersAction() error {
+	if !*testnet {
+		return fmt.Errorf("stub users can only be added to the testnet " +
+			"database")
+	}
+	if *count <= 0 {
+		return fmt.Errorf("count must be positive")
+	}
+
+	// The minimum cost keeps generating many users fast.
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*stubPassword),
+		bcrypt.MinCost)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = confirmChange("stubusers", fmt.Sprintf("create %v stub users",
+		*count))
+	if err != nil {
+		return err
+	}
+
+	rand.Seed(time.Now().UnixNano())
+	var created int
+	for index := 0; created < *count; index++ {
+		u, err := newStubUser(index, hashedPassword)
+		if err != nil {
+			return err
+		}
+
+		err = db.UserNew(*u)
+		if err == database.ErrUserExists {
+			// Left over from a previous run.
+			continue
+		} else if err != nil {
+			return err
+		}
+		created++
+
+		if created%100 == 0 {
+			fmt.Printf("Created %v/%v users\n", created, *count)
+		}
+	}
+
+	err = audit(db, "stubusers", "", fmt.Sprintf("%v stub users created",
+		created))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%v stub users created with password %v\n", created,
+		*stubPassword)
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/decred/politeia/politeiawww/database"
+)
+
+// disable2FAAction removes the two-factor authentication of a user that has
+// lost both the device and the recovery codes.
+func disable2FAAction() error {
+	args := flag.Args()
+	if len(args) != 1 {
+		flag.Usage()
+		return nil
+	}
+	email := args[0]
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	u, err := db.UserGet(email)
+	if err != nil {
+		return fmt.Errorf("user with email %v: %v", email, err)
+	}
+	if u.TOTP == nil {
+		return fmt.Errorf("user with email %v: %v", email,
+			database.ErrTOTPNotEnrolled)
+	}
+
+	diff := fmt.Sprintf("two-factor authentication disabled, %v unused "+
+		"recovery codes removed", len(u.TOTP.RecoveryCodes))
+	if *reason != "" {
+		diff += "; reason: " + *reason
+	}
+	if err = confirmChange(email, diff); err != nil {
+		return err
+	}
+
+	if err = database.RevokeTOTP(u); err != nil {
+		return err
+	}
+	if err = db.UserUpdate(*u); err != nil {
+		return err
+	}
+
+	if err = audit(db, "disable2fa", email, diff); err != nil {
+		return err
+	}
+
+	fmt.Printf("Two-factor authentication of %v disabled\n", email)
+	return nil
+}
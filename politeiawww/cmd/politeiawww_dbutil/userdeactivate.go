@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/decred/politeia/politeiawww/database"
+)
+
+// setDeactivated deactivates or reactivates the user with the given email.
+func setDeactivated(email string, deactivate bool) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	u, err := db.UserGet(email)
+	if err != nil {
+		return fmt.Errorf("user with email %v: %v", email, err)
+	}
+	if u.Deactivated && deactivate {
+		return fmt.Errorf("user with email %v is already deactivated", email)
+	} else if !u.Deactivated && !deactivate {
+		return fmt.Errorf("user with email %v is not deactivated", email)
+	}
+
+	changes := []string{fmt.Sprintf("deactivated: %v -> %v", u.Deactivated,
+		deactivate)}
+	u.Deactivated = deactivate
+
+	if deactivate {
+		// Outstanding tokens would allow the account to be changed while
+		// it is deactivated.  The new user verification token is kept;
+		// clearing it would mark the user as verified.
+		if u.UpdateKeyVerificationToken != nil ||
+			u.ResetPasswordVerificationToken != nil {
+			u.UpdateKeyVerificationToken = nil
+			u.UpdateKeyVerificationExpiry = 0
+			u.ResetPasswordVerificationToken = nil
+			u.ResetPasswordVerificationExpiry = 0
+			changes = append(changes, "verification tokens cleared")
+		}
+
+		if *deactivateIDs {
+			now := time.Now().Unix()
+			var n int
+			for i := range u.Identities {
+				if database.IsIdentityActive(u.Identities[i]) {
+					u.Identities[i].Deactivated = now
+					n++
+				}
+			}
+			changes = append(changes, fmt.Sprintf("%v identities "+
+				"deactivated", n))
+		}
+	}
+
+	diff := strings.Join(changes, ", ")
+	if *reason != "" {
+		diff += "; reason: " + *reason
+	}
+	if err = confirmChange(email, diff); err != nil {
+		return err
+	}
+
+	if err = db.UserUpdate(*u); err != nil {
+		return err
+	}
+
+	// Log the user out everywhere.
+	if deactivate {
+		if err = db.SessionsDeleteByUserID(u.ID); err != nil {
+			return err
+		}
+	}
+
+	action := "reactivateuser"
+	if deactivate {
+		action = "deactivateuser"
+	}
+	if err = audit(db, action, email, diff); err != nil {
+		return err
+	}
+
+	fmt.Printf("User with email %v updated: %v\n", email, diff)
+	return nil
+}
+
+func deactivateUserAction() error {
+	args := flag.Args()
+	if len(args) != 1 {
+		flag.Usage()
+		return nil
+	}
+
+	return setDeactivated(args[0], true)
+}
+
+func reactivateUserAction() error {
+	args := flag.Args()
+	if len(args) != 1 {
+		flag.Usage()
+		return nil
+	}
+	if *deactivateIDs {
+		return fmt.Errorf("--deactivateidentities can only be used with " +
+			"--deactivateuser")
+	}
+
+	return setDeactivated(args[0], false)
+}
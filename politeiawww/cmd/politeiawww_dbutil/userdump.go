@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/decred/politeia/politeiawww/database"
+	"github.com/decred/politeia/politeiawww/database/localdb"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+
+	// redacted replaces the value of sensitive fields in user dumps.
+	redacted = "[redacted]"
+)
+
+var (
+	// userFieldNames contains the lowercase names of the user record fields
+	// in the order they are declared.
+	userFieldNames = func() []string {
+		t := reflect.TypeOf(database.User{})
+		names := make([]string, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			names = append(names, strings.ToLower(t.Field(i).Name))
+		}
+		return names
+	}()
+
+	// sensitiveUserFields contains the user fields that are redacted unless
+	// --unredacted is specified.
+	sensitiveUserFields = map[string]bool{
+		"hashedpassword":                 true,
+		"newuserverificationtoken":       true,
+		"updatekeyverificationtoken":     true,
+		"resetpasswordverificationtoken": true,
+		"totp":                           true,
+		"emailchangeverificationtoken":   true,
+	}
+)
+
+// userFields returns the user fields that are selected with --fields.
+func userFields() ([]string, error) {
+	if *fields == "" {
+		return userFieldNames, nil
+	}
+
+	valid := make(map[string]bool, len(userFieldNames))
+	for _, name := range userFieldNames {
+		valid[name] = true
+	}
+
+	var selected []string
+	for _, name := range strings.Split(*fields, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !valid[name] {
+			return nil, fmt.Errorf("invalid field %v; valid fields are: %v",
+				name, strings.Join(userFieldNames, ","))
+		}
+		selected = append(selected, name)
+	}
+
+	return selected, nil
+}
+
+// userValues returns the JSON encoded value of every field of the user
+// record, keyed by lowercase field name.  Fields are encoded one by one so
+// that fields which are omitted from the stored record when they are not set
+// are still included.  Sensitive fields are replaced with a placeholder if
+// redact is true.
+func userValues(u *database.User, redact bool) (map[string]json.RawMessage, error) {
+	v := reflect.ValueOf(*u)
+	values := make(map[string]json.RawMessage, v.NumField())
+	for i, name := range userFieldNames {
+		b, err := json.Marshal(v.Field(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		if sensitiveUserFields[name] && redact && string(b) != "null" {
+			b = []byte(strconv.Quote(redacted))
+		}
+		values[name] = b
+	}
+
+	return values, nil
+}
+
+// redactUser returns a copy of the user in which the sensitive fields that
+// are set are replaced with a placeholder.  It is used by dumps that print
+// the record as is instead of through userValues.
+func redactUser(u database.User) database.User {
+	v := reflect.ValueOf(&u).Elem()
+	for i, name := range userFieldNames {
+		f := v.Field(i)
+		if !sensitiveUserFields[name] || f.Kind() != reflect.Slice ||
+			f.Len() == 0 {
+			continue
+		}
+		f.SetBytes([]byte(redacted))
+	}
+	if u.TOTP != nil {
+		totp := *u.TOTP
+		totp.Secret = []byte(redacted)
+		totp.RecoveryCodes = nil
+		u.TOTP = &totp
+	}
+	return u
+}
+
+// historyValues returns the previous versions of a user record in the form
+// that is reported by --userhistory with --json.
+func historyValues(history []database.UserHistoryEntry, redact bool) ([]map[string]interface{}, error) {
+	versions := make([]map[string]interface{}, 0, len(history))
+	for _, h := range history {
+		values, err := userValues(&h.User, redact)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, map[string]interface{}{
+			"version":   h.Version,
+			"timestamp": h.Timestamp,
+			"user":      values,
+		})
+	}
+	return versions, nil
+}
+
+// userDumper writes user records to stdout in the selected format.
+type userDumper struct {
+	format string
+	fields []string
+	csv    *csv.Writer
+}
+
+func newUserDumper(format string) (*userDumper, error) {
+	if format != formatJSON && format != formatCSV {
+		return nil, fmt.Errorf("invalid format %v; must be %v or %v",
+			format, formatJSON, formatCSV)
+	}
+
+	f, err := userFields()
+	if err != nil {
+		return nil, err
+	}
+
+	d := userDumper{
+		format: format,
+		fields: f,
+	}
+	if format == formatCSV {
+		d.csv = csv.NewWriter(os.Stdout)
+		err = d.csv.Write(f)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &d, nil
+}
+
+// dump writes a single user record.  JSON dumps contain one object per line
+// so that they can be streamed.
+func (d *userDumper) dump(u *database.User) error {
+	values, err := userValues(u, !*unredacted)
+	if err != nil {
+		return err
+	}
+
+	if d.format == formatJSON {
+		obj := make(map[string]json.RawMessage, len(d.fields))
+		for _, name := range d.fields {
+			obj[name] = values[name]
+		}
+		b, err := json.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", b)
+		return nil
+	}
+
+	// Strings are written unquoted, everything else as JSON.
+	row := make([]string, 0, len(d.fields))
+	for _, name := range d.fields {
+		var s string
+		if err := json.Unmarshal(values[name], &s); err == nil {
+			row = append(row, s)
+			continue
+		}
+		row = append(row, string(values[name]))
+	}
+	return d.csv.Write(row)
+}
+
+// flush flushes any buffered output.
+func (d *userDumper) flush() error {
+	if d.csv == nil {
+		return nil
+	}
+	d.csv.Flush()
+	return d.csv.Error()
+}
+
+// lookupUser returns the user identified by an email, username or user ID.
+func lookupUser(db database.Database, s string) (*database.User, error) {
+	var (
+		u   *database.User
+		err error
+	)
+	if strings.Contains(s, "@") {
+		u, err = db.UserGet(s)
+	} else if id, perr := strconv.ParseUint(s, 10, 64); perr == nil {
+		u, err = db.UserGetById(id)
+	} else {
+		u, err = db.UserGetByUsername(s)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The lookups by ID and username return a nil user if there is no
+	// match.
+	if u == nil {
+		return nil, database.ErrUserNotFound
+	}
+
+	return u, nil
+}
+
+// lookupRawUser returns the user identified by an email, username or user ID
+// from the raw database, which is neither upgraded nor modified.
+func lookupRawUser(userdb *leveldb.DB, s string) (*database.User, error) {
+	if strings.Contains(s, "@") {
+		b, err := userdb.Get([]byte(strings.ToLower(s)), nil)
+		if err == leveldb.ErrNotFound {
+			return nil, database.ErrUserNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		return localdb.DecodeUser(b)
+	}
+
+	id, perr := strconv.ParseUint(s, 10, 64)
+	iter := userdb.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if !localdb.IsUserRecord(string(iter.Key())) {
+			continue
+		}
+		u, err := localdb.DecodeUser(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		if (perr == nil && u.ID == id) ||
+			(perr != nil && strings.ToLower(u.Username) == strings.ToLower(s)) {
+			return u, nil
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	return nil, database.ErrUserNotFound
+}
+
+// dumpUsersAction dumps the user records, or a single user identified by
+// email, username or ID, in the format selected with --format.
+func dumpUsersAction() error {
+	d, err := newUserDumper(*format)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	args := flag.Args()
+	if len(args) == 1 {
+		u, err := lookupUser(db, args[0])
+		if err != nil {
+			return fmt.Errorf("user %v: %v", args[0], err)
+		}
+		if err := d.dump(u); err != nil {
+			return err
+		}
+		return d.flush()
+	}
+
+	var dumpErr error
+	err = db.AllUsers(func(u *database.User) {
+		if dumpErr != nil {
+			return
+		}
+		dumpErr = d.dump(u)
+	})
+	if err != nil {
+		return err
+	}
+	if dumpErr != nil {
+		return dumpErr
+	}
+
+	return d.flush()
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/decred/politeia/politeiawww/database"
+)
+
+// setFlags collects the values of a flag that may be repeated.
+type setFlags []string
+
+// String satisfies the flag.Value interface.
+func (s *setFlags) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set satisfies the flag.Value interface.
+func (s *setFlags) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// applySetFlags applies field=value assignments to the user record.  Values
+// that are valid JSON are used as is, anything else is treated as a string.
+func applySetFlags(u *database.User, sets []string) error {
+	obj := make(map[string]json.RawMessage, len(sets))
+	for _, set := range sets {
+		kv := strings.SplitN(set, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid --set %v: must be field=value", set)
+		}
+
+		value := json.RawMessage(kv[1])
+		if !json.Valid(value) {
+			b, err := json.Marshal(kv[1])
+			if err != nil {
+				return err
+			}
+			value = b
+		}
+		obj[strings.ToLower(kv[0])] = value
+	}
+
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	return d.Decode(u)
+}
+
+// editInEditor opens the user record in $EDITOR and decodes the result.
+func editInEditor(u *database.User) (*database.User, error) {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		return nil, fmt.Errorf("$EDITOR is not set; use --set field=value")
+	}
+
+	b, err := json.MarshalIndent(u, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := ioutil.TempFile("", "politeiawww_dbutil")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(append(b, '\n'))
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// $EDITOR may include arguments, e.g. "code --wait".
+	argv := append(strings.Fields(editor), f.Name())
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%v: %v", editor, err)
+	}
+
+	b, err = ioutil.ReadFile(f.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	var edited database.User
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&edited); err != nil {
+		return nil, err
+	}
+
+	return &edited, nil
+}
+
+// userDiff returns a description of the fields that differ between two
+// versions of a user record.  The values of sensitive fields are omitted.
+func userDiff(old, new *database.User) (string, error) {
+	oldValues, err := userValues(old, false)
+	if err != nil {
+		return "", err
+	}
+	newValues, err := userValues(new, false)
+	if err != nil {
+		return "", err
+	}
+
+	var changes []string
+	for _, name := range userFieldNames {
+		o, n := oldValues[name], newValues[name]
+		if bytes.Equal(o, n) {
+			continue
+		}
+		if sensitiveUserFields[name] {
+			changes = append(changes, name+" changed")
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%v: %s -> %s", name, o, n))
+	}
+
+	return strings.Join(changes, ", "), nil
+}
+
+func editUserAction() error {
+	args := flag.Args()
+	if len(args) != 1 {
+		flag.Usage()
+		return nil
+	}
+	email := args[0]
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	u, err := db.UserGet(email)
+	if err != nil {
+		return fmt.Errorf("user with email %v: %v", email, err)
+	}
+
+	var edited *database.User
+	if len(sets) > 0 {
+		c := *u
+		edited = &c
+		err = applySetFlags(edited, sets)
+	} else {
+		edited, err = editInEditor(u)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The email is the lookup key and the ID is referenced elsewhere, so
+	// neither may be changed here.
+	if edited.Email != u.Email {
+		return fmt.Errorf("email can't be changed with --edituser")
+	}
+	if edited.ID != u.ID {
+		return fmt.Errorf("id can't be changed")
+	}
+	if err := validateImportedUser(edited); err != nil {
+		return err
+	}
+	if edited.Username != u.Username {
+		taken, err := db.UserGetByUsername(edited.Username)
+		if err != nil {
+			return err
+		} else if taken != nil && taken.ID != u.ID {
+			return fmt.Errorf("username %v is already taken",
+				edited.Username)
+		}
+	}
+
+	diff, err := userDiff(u, edited)
+	if err != nil {
+		return err
+	}
+	if diff == "" {
+		fmt.Printf("No changes\n")
+		return nil
+	}
+
+	if err = confirmChange(email, diff); err != nil {
+		return err
+	}
+
+	if err = db.UserUpdate(*edited); err != nil {
+		return err
+	}
+
+	if err = audit(db, "edituser", email, diff); err != nil {
+		return err
+	}
+
+	fmt.Printf("User with email %v updated: %v\n", email, diff)
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/decred/politeia/politeiawww/database"
+)
+
+// identityStatus returns a human readable status of an identity.
+func identityStatus(id database.Identity) string {
+	switch {
+	case database.IsIdentityActive(id):
+		return "active"
+	case id.Activated == 0:
+		return "pending"
+	default:
+		return "deactivated"
+	}
+}
+
+// findIdentity returns the index of the identity with the given hex encoded
+// public key.
+func findIdentity(u *database.User, pubkey string) (int, error) {
+	key, err := hex.DecodeString(pubkey)
+	if err != nil {
+		return 0, fmt.Errorf("invalid public key %v: %v", pubkey, err)
+	}
+	for i, id := range u.Identities {
+		if string(id.Key[:]) == string(key) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("user with email %v has no identity %v", u.Email,
+		pubkey)
+}
+
+func printIdentities(u *database.User) {
+	for _, id := range u.Identities {
+		fmt.Printf("%v\n", hex.EncodeToString(id.Key[:]))
+		fmt.Printf("  Status      : %v\n", identityStatus(id))
+		if id.Activated != 0 {
+			fmt.Printf("  Activated   : %v\n", time.Unix(id.Activated, 0))
+		}
+		if id.Deactivated != 0 {
+			fmt.Printf("  Deactivated : %v\n", time.Unix(id.Deactivated, 0))
+		}
+	}
+	fmt.Printf("%v identities\n", len(u.Identities))
+}
+
+func identitiesAction() error {
+	args := flag.Args()
+	if len(args) != 1 && len(args) != 3 {
+		flag.Usage()
+		return nil
+	}
+	email := args[0]
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	u, err := db.UserGet(email)
+	if err != nil {
+		return fmt.Errorf("user with email %v: %v", email, err)
+	}
+
+	if len(args) == 1 {
+		printIdentities(u)
+		return nil
+	}
+
+	action, pubkey := args[1], args[2]
+	i, err := findIdentity(u, pubkey)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	switch action {
+	case "deactivate":
+		if !database.IsIdentityActive(u.Identities[i]) {
+			return fmt.Errorf("identity %v is not active", pubkey)
+		}
+		u.Identities[i].Deactivated = now
+	case "activate":
+		if database.IsIdentityActive(u.Identities[i]) {
+			return fmt.Errorf("identity %v is already active", pubkey)
+		}
+
+		// A user only has one active identity at a time.
+		for j := range u.Identities {
+			if database.IsIdentityActive(u.Identities[j]) {
+				u.Identities[j].Deactivated = now
+			}
+		}
+		u.Identities[i].Activated = now
+		u.Identities[i].Deactivated = 0
+
+		// Activating the pending identity completes the key update.
+		if i == len(u.Identities)-1 {
+			u.UpdateKeyVerificationToken = nil
+			u.UpdateKeyVerificationExpiry = 0
+		}
+	default:
+		return fmt.Errorf("invalid action %v: must be activate or "+
+			"deactivate", action)
+	}
+
+	diff := fmt.Sprintf("identity %v %vd", pubkey, action)
+	if err = confirmChange(email, diff); err != nil {
+		return err
+	}
+
+	if err = db.UserUpdate(*u); err != nil {
+		return err
+	}
+
+	if err = audit(db, action+"identity", email, diff); err != nil {
+		return err
+	}
+
+	printIdentities(u)
+	return nil
+}
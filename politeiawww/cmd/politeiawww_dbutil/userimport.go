@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/badoux/checkmail"
+	"github.com/decred/politeia/politeiawww/database"
+)
+
+// decodeImportedUser decodes a user record from a JSON dump on top of u.
+// Fields that are not present in the dump keep the value they have in u.
+func decodeImportedUser(raw json.RawMessage, u *database.User) error {
+	var values map[string]json.RawMessage
+	err := json.Unmarshal(raw, &values)
+	if err != nil {
+		return err
+	}
+	for k, v := range values {
+		if sensitiveUserFields[strings.ToLower(k)] &&
+			string(v) == fmt.Sprintf("%q", redacted) {
+			return fmt.Errorf("field %v is redacted; dump with "+
+				"--unredacted to import it", k)
+		}
+	}
+
+	d := json.NewDecoder(strings.NewReader(string(raw)))
+	d.DisallowUnknownFields()
+	return d.Decode(u)
+}
+
+// validateImportedUser verifies that an imported user record is usable.
+func validateImportedUser(u *database.User) error {
+	if err := checkmail.ValidateFormat(u.Email); err != nil {
+		return fmt.Errorf("invalid email %v: %v", u.Email, err)
+	}
+	if strings.TrimSpace(u.Username) == "" {
+		return fmt.Errorf("missing username")
+	}
+	return nil
+}
+
+// importUser writes a single user record from a JSON dump.  It returns the
+// email of the user, the action that was taken and what changed.  Nothing is
+// written with --dryrun.
+func importUser(db database.Database, raw json.RawMessage) (string, string, string, error) {
+	// Decode once to learn the email so that the record can be merged
+	// with an existing user.
+	var u database.User
+	if err := decodeImportedUser(raw, &u); err != nil {
+		return "", "", "", err
+	}
+	if err := checkmail.ValidateFormat(u.Email); err != nil {
+		return "", "", "", fmt.Errorf("invalid email %v: %v", u.Email, err)
+	}
+
+	existing, err := db.UserGet(u.Email)
+	switch {
+	case err == database.ErrUserNotFound:
+		if err := validateImportedUser(&u); err != nil {
+			return "", "", "", err
+		}
+
+		// Look for a username collision with a different user.
+		taken, err := db.UserGetByUsername(u.Username)
+		if err != nil {
+			return "", "", "", err
+		} else if taken != nil {
+			return "", "", "", fmt.Errorf("username %v is already taken",
+				u.Username)
+		}
+
+		// New users are assigned an ID by the destination database.
+		if !*dryRun {
+			err = db.UserNew(u)
+			if err != nil {
+				return "", "", "", err
+			}
+		}
+		return u.Email, "created", "new user " + u.Username, nil
+	case err != nil:
+		return "", "", "", err
+	case *skipExisting:
+		return u.Email, "skipped", "", nil
+	case !*updateExisting:
+		return "", "", "", fmt.Errorf("user already exists; use --skipexisting " +
+			"or --updateexisting")
+	}
+
+	// Apply the dumped fields on top of the existing record.  The ID of
+	// the existing user is kept.
+	merged := *existing
+	if err := decodeImportedUser(raw, &merged); err != nil {
+		return "", "", "", err
+	}
+	merged.ID = existing.ID
+	if err := validateImportedUser(&merged); err != nil {
+		return "", "", "", err
+	}
+	diff, err := userDiff(existing, &merged)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if !*dryRun {
+		err = db.UserUpdate(merged)
+		if err != nil {
+			return "", "", "", err
+		}
+	}
+	return u.Email, "updated", diff, nil
+}
+
+// importAction imports the user records from a JSON dump produced by
+// --dump --format=json.
+func importAction() error {
+	args := flag.Args()
+	if len(args) != 1 {
+		flag.Usage()
+		return nil
+	}
+	if *skipExisting && *updateExisting {
+		return fmt.Errorf("--skipexisting and --updateexisting are " +
+			"mutually exclusive")
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// With --dryrun every record is checked and its change printed
+	// instead.
+	if !*dryRun {
+		err = confirmChange("import", "import users from "+args[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	counts := make(map[string]int)
+	d := json.NewDecoder(f)
+	for n := 1; ; n++ {
+		var raw json.RawMessage
+		err := d.Decode(&raw)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("record %v: %v", n, err)
+		}
+
+		email, action, diff, err := importUser(db, raw)
+		if err != nil {
+			return fmt.Errorf("record %v: %v", n, err)
+		}
+		counts[action]++
+
+		if action == "skipped" {
+			continue
+		}
+		if *dryRun {
+			if diff == "" {
+				diff = "no changes"
+			}
+			fmt.Printf("%v %v: %v\n", email, action, diff)
+			continue
+		}
+		err = audit(db, "import", email, fmt.Sprintf("user %v from %v",
+			action, args[0]))
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("%v users created, %v updated, %v skipped\n",
+		counts["created"], counts["updated"], counts["skipped"])
+	if *dryRun {
+		return errDryRun
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	www "github.com/decred/politeia/politeiawww/api/v1"
+	"github.com/decred/politeia/politeiawww/database"
+)
+
+// validUsername matches the usernames that politeiawww accepts.
+var validUsername = regexp.MustCompile(createUsernameRegex())
+
+// createUsernameRegex builds the username regular expression from the
+// politeiawww username policy.
+func createUsernameRegex() string {
+	var buf bytes.Buffer
+	buf.WriteString("^[")
+
+	for _, supportedChar := range www.PolicyUsernameSupportedChars {
+		if len(supportedChar) > 1 {
+			buf.WriteString(supportedChar)
+		} else {
+			buf.WriteString(`\` + supportedChar)
+		}
+	}
+	buf.WriteString("]{")
+	buf.WriteString(strconv.Itoa(www.PolicyMinUsernameLength) + ",")
+	buf.WriteString(strconv.Itoa(www.PolicyMaxUsernameLength) + "}$")
+
+	return buf.String()
+}
+
+func setEmailAction() error {
+	args := flag.Args()
+	if len(args) != 2 {
+		flag.Usage()
+		return nil
+	}
+	oldEmail := args[0]
+	newEmail := strings.ToLower(args[1])
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	diff := fmt.Sprintf("email: %v -> %v", oldEmail, newEmail)
+	if err = confirmChange(oldEmail, diff); err != nil {
+		return err
+	}
+
+	err = db.UserChangeEmail(oldEmail, newEmail)
+	switch err {
+	case nil:
+	case database.ErrUserExists:
+		return fmt.Errorf("email %v is already in use", newEmail)
+	case database.ErrUserNotFound:
+		return fmt.Errorf("user with email %v: %v", oldEmail, err)
+	default:
+		return err
+	}
+
+	if err = audit(db, "setemail", newEmail, diff); err != nil {
+		return err
+	}
+
+	fmt.Printf("User with email %v changed to %v\n", oldEmail, newEmail)
+	return nil
+}
+
+func setUsernameAction() error {
+	args := flag.Args()
+	if len(args) != 2 {
+		flag.Usage()
+		return nil
+	}
+	email := args[0]
+
+	// Usernames are stored in the format politeiawww uses.
+	username := strings.ToLower(strings.TrimSpace(args[1]))
+	if !validUsername.MatchString(username) {
+		return fmt.Errorf("invalid username %v: must match %v", username,
+			validUsername)
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	u, err := db.UserGet(email)
+	if err != nil {
+		return fmt.Errorf("user with email %v: %v", email, err)
+	}
+
+	taken, err := db.UserGetByUsername(username)
+	if err != nil {
+		return err
+	} else if taken != nil {
+		return fmt.Errorf("username %v is already taken", username)
+	}
+
+	diff := fmt.Sprintf("username: %v -> %v", u.Username, username)
+	u.Username = username
+
+	if err = confirmChange(email, diff); err != nil {
+		return err
+	}
+
+	if err = db.UserUpdate(*u); err != nil {
+		return err
+	}
+
+	if err = audit(db, "setusername", email, diff); err != nil {
+		return err
+	}
+
+	fmt.Printf("User with email %v renamed to %v\n", email, username)
+	return nil
+}
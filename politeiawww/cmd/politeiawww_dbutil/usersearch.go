@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+
+	"github.com/decred/politeia/politeiawww/database"
+)
+
+// userFilter matches user records against the search flags.
+type userFilter struct {
+	createdAfter int64
+	emailRegex   *regexp.Regexp
+}
+
+func newUserFilter() (*userFilter, error) {
+	var f userFilter
+	if *createdAfter != "" {
+		t, err := parseDate(*createdAfter)
+		if err != nil {
+			return nil, err
+		}
+		f.createdAfter = t
+	}
+	if *emailRegex != "" {
+		r, err := regexp.Compile(*emailRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid email regex: %v", err)
+		}
+		f.emailRegex = r
+	}
+	return &f, nil
+}
+
+// userCreated returns the unix timestamp of when the user was created.  The
+// first identity is added when the user signs up.
+func userCreated(u *database.User) int64 {
+	if len(u.Identities) == 0 {
+		return 0
+	}
+	return u.Identities[0].Activated
+}
+
+// userUnpaid returns whether the user was issued a registration paywall that
+// has not been paid.
+func userUnpaid(u *database.User) bool {
+	return u.NewUserPaywallAddress != "" && u.NewUserPaywallTx == ""
+}
+
+// match returns whether the user matches every filter that is set.
+func (f *userFilter) match(u *database.User) bool {
+	if *filterAdmin && !u.Admin {
+		return false
+	}
+	if *deactivated && !u.Deactivated {
+		return false
+	}
+	if *unpaid && !userUnpaid(u) {
+		return false
+	}
+	if *noProposals && len(u.SpentProposalCredits) > 0 {
+		return false
+	}
+	if f.createdAfter != 0 && userCreated(u) < f.createdAfter {
+		return false
+	}
+	if f.emailRegex != nil && !f.emailRegex.MatchString(u.Email) {
+		return false
+	}
+	return true
+}
+
+// searchResult is a user that matched --searchusers.
+type searchResult struct {
+	ID       uint64 `json:"id"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Admin    bool   `json:"admin"`
+}
+
+func searchUsersAction() error {
+	if len(flag.Args()) != 0 {
+		flag.Usage()
+		return nil
+	}
+	if *offset < 0 || *limit < 0 {
+		return fmt.Errorf("offset and limit must not be negative")
+	}
+
+	f, err := newUserFilter()
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var (
+		matches int
+		users   = make([]searchResult, 0)
+	)
+	err = db.AllUsers(func(u *database.User) {
+		if !f.match(u) {
+			return
+		}
+		matches++
+		if matches <= *offset || (*limit != 0 && len(users) >= *limit) {
+			return
+		}
+		users = append(users, searchResult{
+			ID:       u.ID,
+			Email:    u.Email,
+			Username: u.Username,
+			Admin:    u.Admin,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	printResult(map[string]interface{}{
+		"matches": matches,
+		"users":   users,
+	}, func() {
+		for _, u := range users {
+			fmt.Printf("%-6v %-32v %-20v admin=%v\n", u.ID, u.Email,
+				u.Username, u.Admin)
+		}
+		fmt.Printf("%v of %v matching users shown\n", len(users), matches)
+	})
+	return nil
+}
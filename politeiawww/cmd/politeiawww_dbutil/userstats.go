@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/decred/politeia/politeiawww/database"
+)
+
+// userStats summarizes the user records.
+type userStats struct {
+	Users              int `json:"users"`
+	Admins             int `json:"admins"`
+	Deactivated        int `json:"deactivated"`
+	Unpaid             int `json:"unpaid"` // Users with an unpaid registration paywall
+	UnspentCredits     int `json:"unspentcredits"`
+	SpentCredits       int `json:"spentcredits"`
+	Identities         int `json:"identities"`
+	ActiveIdentities   int `json:"activeidentities"`
+	UsersWithoutActive int `json:"userswithoutactive"` // Users without an active identity
+}
+
+// add adds a single user record to the stats.
+func (s *userStats) add(u *database.User) {
+	s.Users++
+	if u.Admin {
+		s.Admins++
+	}
+	if u.Deactivated {
+		s.Deactivated++
+	}
+	if userUnpaid(u) {
+		s.Unpaid++
+	}
+	s.UnspentCredits += len(u.UnspentProposalCredits)
+	s.SpentCredits += len(u.SpentProposalCredits)
+
+	var active bool
+	for _, id := range u.Identities {
+		s.Identities++
+		if database.IsIdentityActive(id) {
+			s.ActiveIdentities++
+			active = true
+		}
+	}
+	if !active {
+		s.UsersWithoutActive++
+	}
+}
+
+func statsAction() error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var s userStats
+	err = db.AllUsers(s.add)
+	if err != nil {
+		return err
+	}
+
+	printResult(s, func() {
+		fmt.Printf("Users                        : %v\n", s.Users)
+		fmt.Printf("Admins                       : %v\n", s.Admins)
+		fmt.Printf("Deactivated                  : %v\n", s.Deactivated)
+		fmt.Printf("Unpaid registration paywalls : %v\n", s.Unpaid)
+		fmt.Printf("Unspent proposal credits     : %v\n", s.UnspentCredits)
+		fmt.Printf("Spent proposal credits       : %v\n", s.SpentCredits)
+		fmt.Printf("Identities                   : %v\n", s.Identities)
+		fmt.Printf("Active identities            : %v\n", s.ActiveIdentities)
+		fmt.Printf("Users without active identity: %v\n", s.UsersWithoutActive)
+	})
+	return nil
+}
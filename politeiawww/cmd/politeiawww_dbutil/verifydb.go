@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/decred/politeia/politeiawww/database"
+	"github.com/decred/politeia/politeiawww/database/localdb"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// verifyCheckpointInterval is the number of records that are verified
+// between two checkpoints of --verifydb.
+const verifyCheckpointInterval = 1000
+
+// Checks performed by --verifydb.
+const (
+	checkRecords    = "records"
+	checkVersion    = "version"
+	checkUserIDs    = "user ids"
+	checkUsernames  = "usernames"
+	checkPublicKeys = "public keys"
+	checkPaywalls   = "paywalls"
+	checkCredits    = "proposal credits"
+)
+
+var verifyChecks = []string{checkRecords, checkVersion, checkUserIDs,
+	checkUsernames, checkPublicKeys, checkPaywalls, checkCredits}
+
+// verifyFailure is a single failed check.  Failures are kept in the
+// checkpoint of an interrupted run.
+type verifyFailure struct {
+	Check string `json:"check"`
+	Key   string `json:"key"`
+	Err   string `json:"error"`
+}
+
+// verifyReport collects the results of --verifydb.
+type verifyReport struct {
+	records  int
+	users    int
+	failures []verifyFailure
+}
+
+func (r *verifyReport) fail(check, key, format string, args ...interface{}) {
+	r.failures = append(r.failures, verifyFailure{
+		Check: check,
+		Key:   key,
+		Err:   fmt.Sprintf(format, args...),
+	})
+}
+
+// print writes the report to stdout.
+func (r *verifyReport) print() {
+	counts := make(map[string]int)
+	for _, f := range r.failures {
+		counts[f.Check]++
+	}
+
+	fmt.Printf("%v records, %v users\n", r.records, r.users)
+	for _, check := range verifyChecks {
+		status := "ok"
+		if counts[check] > 0 {
+			status = fmt.Sprintf("%v failures", counts[check])
+		}
+		fmt.Printf("  %-17v: %v\n", check, status)
+	}
+
+	if len(r.failures) == 0 {
+		return
+	}
+	fmt.Printf("Failures:\n")
+	for _, f := range r.failures {
+		fmt.Printf("  [%v] %v: %v\n", f.Check, f.Key, f.Err)
+	}
+}
+
+// result returns the report as a structured --json result.
+func (r *verifyReport) result() interface{} {
+	checks := make(map[string]int)
+	for _, check := range verifyChecks {
+		checks[check] = 0
+	}
+	failures := make([]map[string]string, 0, len(r.failures))
+	for _, f := range r.failures {
+		checks[f.Check]++
+		failures = append(failures, map[string]string{
+			"check": f.Check,
+			"key":   f.Key,
+			"error": f.Err,
+		})
+	}
+
+	return map[string]interface{}{
+		"records":  r.records,
+		"users":    r.users,
+		"checks":   checks,
+		"failures": failures,
+	}
+}
+
+// verifyRawRecords checks the records that localdb creates when it opens the
+// database.  It must run before the database is opened through localdb.
+func verifyRawRecords(r *verifyReport, userdb *leveldb.DB) (lastUserID uint64, hasUsers bool, err error) {
+	v, err := userdb.Get([]byte(localdb.UserVersionKey), nil)
+	switch err {
+	case nil:
+		version, err := localdb.DecodeVersion(v)
+		if err != nil {
+			r.fail(checkVersion, localdb.UserVersionKey, "%v", err)
+		} else if version.Version > localdb.UserVersion {
+			// Older versions are upgraded when the database is
+			// opened below.
+			r.fail(checkVersion, localdb.UserVersionKey,
+				"version %v, expected at most %v", version.Version,
+				localdb.UserVersion)
+		}
+	case leveldb.ErrNotFound:
+		r.fail(checkVersion, localdb.UserVersionKey, "missing")
+	default:
+		return 0, false, err
+	}
+
+	b, err := userdb.Get([]byte(localdb.LastUserIdKey), nil)
+	switch err {
+	case nil:
+		if len(b) == 8 {
+			return binary.LittleEndian.Uint64(b), true, nil
+		}
+		// Reported by VerifyIntegrity.
+		return 0, false, nil
+	case leveldb.ErrNotFound:
+		return 0, false, nil
+	default:
+		return 0, false, err
+	}
+}
+
+// verifyUserPaywalls checks the proposal paywalls and credits of a user.
+func verifyUserPaywalls(r *verifyReport, u *database.User) {
+	// Proposal paywall IDs are assigned sequentially starting at 1.
+	for i, p := range u.ProposalPaywalls {
+		if p.ID != uint64(i+1) {
+			r.fail(checkPaywalls, u.Email, "paywall %v has id %v", i, p.ID)
+		}
+	}
+
+	for _, c := range u.UnspentProposalCredits {
+		if c.PaywallID > uint64(len(u.ProposalPaywalls)) {
+			r.fail(checkCredits, u.Email, "unspent credit from unknown "+
+				"paywall %v", c.PaywallID)
+		}
+		if c.CensorshipToken != "" {
+			r.fail(checkCredits, u.Email, "unspent credit used by "+
+				"proposal %v", c.CensorshipToken)
+		}
+	}
+	for _, c := range u.SpentProposalCredits {
+		if c.PaywallID > uint64(len(u.ProposalPaywalls)) {
+			r.fail(checkCredits, u.Email, "spent credit from unknown "+
+				"paywall %v", c.PaywallID)
+		}
+		if c.CensorshipToken == "" {
+			r.fail(checkCredits, u.Email, "spent credit without "+
+				"proposal")
+		}
+	}
+}
+
+// verifyRecords runs the per record checks on the raw database, starting
+// after the cursor of the checkpoint.  The position and the failures found so
+// far are saved in the checkpoint every verifyCheckpointInterval records so
+// that an interrupted run can be continued with --resume.
+func verifyRecords(r *verifyReport, userdb *leveldb.DB, cp *checkpoint) error {
+	if cp.State != nil {
+		var failures []verifyFailure
+		if err := json.Unmarshal(cp.State, &failures); err != nil {
+			return fmt.Errorf("invalid checkpoint %v: %v",
+				checkpointPath(cp.Action), err)
+		}
+		r.failures = append(r.failures, failures...)
+	}
+	r.records = cp.Done
+
+	// Only the failures of the per record checks are saved, the other
+	// checks are repeated when the run is resumed.
+	var lastKey string
+	save := func() error {
+		var failures []verifyFailure
+		for _, f := range r.failures {
+			if f.Check == checkRecords {
+				failures = append(failures, f)
+			}
+		}
+		state, err := json.Marshal(failures)
+		if err != nil {
+			return err
+		}
+		cp.Cursor = []byte(lastKey)
+		cp.Done = r.records
+		cp.State = state
+		return cp.save()
+	}
+
+	prog := newProgress("verifydb", 0, cp.Done)
+	var saveErr error
+	err := localdb.VerifyRecordsRange(userdb, cp.resumeRange(),
+		func(key string, err error) {
+			r.records++
+			prog.add(1)
+			if err != nil {
+				prog.fail()
+				r.fail(checkRecords, key, "%v", err)
+			}
+			lastKey = key
+			if (r.records-cp.Done)%verifyCheckpointInterval == 0 &&
+				saveErr == nil {
+				saveErr = save()
+			}
+		})
+	if err != nil {
+		return err
+	}
+	if saveErr != nil {
+		return saveErr
+	}
+	prog.finish()
+
+	return nil
+}
+
+func verifyDBAction() error {
+	cp, err := loadCheckpoint("verifydb")
+	if err != nil {
+		return err
+	}
+	switch {
+	case cp != nil && !*resume:
+		return fmt.Errorf("an interrupted verification was found; "+
+			"resume it with --resume or delete %v",
+			checkpointPath("verifydb"))
+	case cp == nil && *resume:
+		return fmt.Errorf("there is no interrupted verification to resume")
+	case cp == nil:
+		cp = &checkpoint{Action: "verifydb"}
+	}
+
+	// The per record checks run on the raw database so that they can be
+	// resumed from the checkpoint.
+	var r verifyReport
+	userdb, err := openRawDB()
+	if err != nil {
+		return err
+	}
+	lastUserID, hasUsers, err := verifyRawRecords(&r, userdb)
+	if err == nil {
+		err = verifyRecords(&r, userdb, cp)
+	}
+	userdb.Close()
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Cross record checks.
+	ids := make(map[uint64]string)
+	usernames := make(map[string]string)
+	pubkeys := make(map[string]string)
+	prog := newProgress("verifydb users", 0, 0)
+	err = db.AllUsers(func(u *database.User) {
+		r.users++
+		prog.add(1)
+		failures := len(r.failures)
+
+		if other, ok := ids[u.ID]; ok {
+			r.fail(checkUserIDs, u.Email, "id %v also used by %v", u.ID,
+				other)
+		}
+		ids[u.ID] = u.Email
+		if !hasUsers || u.ID > lastUserID {
+			r.fail(checkUserIDs, u.Email, "id %v was never allocated",
+				u.ID)
+		}
+
+		username := strings.ToLower(u.Username)
+		if other, ok := usernames[username]; ok {
+			r.fail(checkUsernames, u.Email, "username %v also used by %v",
+				u.Username, other)
+		}
+		usernames[username] = u.Email
+
+		for _, id := range u.Identities {
+			key := hex.EncodeToString(id.Key[:])
+			if other, ok := pubkeys[key]; ok && other != u.Email {
+				r.fail(checkPublicKeys, u.Email, "public key %v also "+
+					"used by %v", key, other)
+			}
+			pubkeys[key] = u.Email
+		}
+
+		verifyUserPaywalls(&r, u)
+		if len(r.failures) > failures {
+			prog.fail()
+		}
+	})
+	if err != nil {
+		return err
+	}
+	prog.finish()
+
+	if err := cp.remove(); err != nil {
+		return err
+	}
+
+	printResult(r.result(), r.print)
+	if len(r.failures) > 0 {
+		return fmt.Errorf("database verification failed")
+	}
+
+	return nil
+}
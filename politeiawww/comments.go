@@ -8,34 +8,38 @@ import (
 
 func (b *backend) convertDecredCommentToWWWComment(c decredplugin.Comment) www.Comment {
 	return www.Comment{
-		Token:       c.Token,
-		ParentID:    c.ParentID,
-		Comment:     c.Comment,
-		Signature:   c.Signature,
-		PublicKey:   c.PublicKey,
-		CommentID:   c.CommentID,
-		Receipt:     c.Receipt,
-		Timestamp:   c.Timestamp,
-		TotalVotes:  c.TotalVotes,
-		ResultVotes: c.ResultVotes,
-		UserID:      b.userPubkeys[c.PublicKey],
-		Censored:    c.Censored,
+		Token:          c.Token,
+		ParentID:       c.ParentID,
+		Comment:        c.Comment,
+		Signature:      c.Signature,
+		PublicKey:      c.PublicKey,
+		CommentID:      c.CommentID,
+		Receipt:        c.Receipt,
+		Timestamp:      c.Timestamp,
+		TotalVotes:     c.TotalVotes,
+		ResultVotes:    c.ResultVotes,
+		UserID:         b.userPubkeys[c.PublicKey],
+		Censored:       c.Censored,
+		CensoredReason: c.CensoredReason,
+		CensoredBy:     c.CensoredBy,
 	}
 }
 
 func convertWWWCommentToDecredComment(c www.Comment) decredplugin.Comment {
 	return decredplugin.Comment{
-		Token:       c.Token,
-		ParentID:    c.ParentID,
-		Comment:     c.Comment,
-		Signature:   c.Signature,
-		PublicKey:   c.PublicKey,
-		CommentID:   c.CommentID,
-		Receipt:     c.Receipt,
-		Timestamp:   c.Timestamp,
-		TotalVotes:  c.TotalVotes,
-		ResultVotes: c.ResultVotes,
-		Censored:    c.Censored,
+		Token:          c.Token,
+		ParentID:       c.ParentID,
+		Comment:        c.Comment,
+		Signature:      c.Signature,
+		PublicKey:      c.PublicKey,
+		CommentID:      c.CommentID,
+		Receipt:        c.Receipt,
+		Timestamp:      c.Timestamp,
+		TotalVotes:     c.TotalVotes,
+		ResultVotes:    c.ResultVotes,
+		Censored:       c.Censored,
+		CensoredReason: c.CensoredReason,
+		CensoredBy:     c.CensoredBy,
 	}
 }
 
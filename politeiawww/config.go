@@ -67,6 +67,8 @@ var (
 		template.New("update_user_key_email_template").Parse(templateUpdateUserKeyEmailRaw))
 	templateUserLockedResetPassword = template.Must(
 		template.New("user_locked_reset_password").Parse(templateUserLockedResetPasswordRaw))
+	templateAdminDigestEmail = template.Must(
+		template.New("admin_digest_email_template").Parse(templateAdminDigestEmailRaw))
 )
 
 // runServiceCommand is only set to a real function on Windows.  It is used
@@ -109,6 +111,7 @@ type config struct {
 	PaywallAmount            uint64 `long:"paywallamount" description:"Amount of DCR (in atoms) required for a user to register or submit a proposal."`
 	PaywallXpub              string `long:"paywallxpub" description:"Extended public key for deriving paywall addresses."`
 	MinConfirmationsRequired uint64 `long:"minconfirmations" description:"Minimum blocks confirmation for accepting paywall as paid. Only works in TestNet."`
+	AdminDigest              bool   `long:"admindigest" description:"Email a daily digest of server activity to all admins."`
 	AdminLogFile             string
 }
 
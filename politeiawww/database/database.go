@@ -7,6 +7,7 @@ package database
 import (
 	"encoding/hex"
 	"errors"
+	"time"
 
 	"github.com/decred/politeia/politeiad/api/v1/identity"
 )
@@ -24,8 +25,79 @@ var (
 
 	// ErrShutdown is emitted when the database is shutting down.
 	ErrShutdown = errors.New("database is shutting down")
+
+	// ErrSessionNotFound indicates that a session was not found in the
+	// database or that it has expired.
+	ErrSessionNotFound = errors.New("session not found")
+
+	// ErrEmailQueueEmpty indicates that there are no queued emails that are
+	// due for delivery.
+	ErrEmailQueueEmpty = errors.New("email queue empty")
+
+	// ErrEmailNotFound indicates that a queued email was not found in the
+	// database.
+	ErrEmailNotFound = errors.New("queued email not found")
+
+	// ErrChecksumMissing indicates that a user record does not have a
+	// checksum stored alongside it.
+	ErrChecksumMissing = errors.New("record checksum missing")
+
+	// ErrChecksumMismatch indicates that the checksum stored alongside a
+	// user record does not match the checksum of the record payload.
+	ErrChecksumMismatch = errors.New("record checksum mismatch")
+
+	// ErrDuplicateOperation indicates that an operation with the same
+	// operation ID has already been applied to the database.
+	ErrDuplicateOperation = errors.New("duplicate operation")
+
+	// ErrUnknownRecord indicates that the type of a database record could not
+	// be determined.
+	ErrUnknownRecord = errors.New("unknown record type")
+
+	// ErrTOTPNotEnrolled indicates that the user has not enrolled in
+	// two-factor authentication.
+	ErrTOTPNotEnrolled = errors.New("two-factor authentication not enrolled")
+
+	// ErrTOTPEnrolled indicates that the user already has confirmed
+	// two-factor authentication.
+	ErrTOTPEnrolled = errors.New("two-factor authentication already enrolled")
+
+	// ErrEmailChangeNotFound indicates that the user has no pending email
+	// change.
+	ErrEmailChangeNotFound = errors.New("no pending email change")
+
+	// ErrEmailChangeTokenInvalid indicates that an email change
+	// verification token does not match the one of the pending change.
+	ErrEmailChangeTokenInvalid = errors.New("invalid email change token")
+
+	// ErrEmailChangeTokenExpired indicates that the pending email change
+	// has expired.
+	ErrEmailChangeTokenExpired = errors.New("email change token expired")
+
+	// ErrPreferencesNotFound indicates that a user has not saved any
+	// preferences.
+	ErrPreferencesNotFound = errors.New("user preferences not found")
+
+	// ErrInviteNotFound indicates that there is no invitation with the
+	// given token.
+	ErrInviteNotFound = errors.New("invitation not found")
+
+	// ErrInviteExpired indicates that an invitation has expired.
+	ErrInviteExpired = errors.New("invitation expired")
+
+	// ErrInviteRedeemed indicates that an invitation has already been used
+	// to register.
+	ErrInviteRedeemed = errors.New("invitation already redeemed")
+
+	// ErrWrongVersion indicates that the database was written by a newer
+	// version of politeiawww.
+	ErrWrongVersion = errors.New("unsupported database version")
 )
 
+// ManualCreditTxID is the transaction ID of proposal credits that were granted
+// with politeiawww_dbutil instead of purchased.
+const ManualCreditTxID = "created_by_dbutil"
+
 // Identity wraps an ed25519 public key and timestamps to indicate if it is
 // active.  If deactivated != 0 then the key is no longer valid.
 type Identity struct {
@@ -99,6 +171,7 @@ type User struct {
 	NewUserPaywallTx                string // Paywall transaction id
 	NewUserPaywallTxNotBefore       int64  // Transactions occurring before this time will not be valid.
 	NewUserPaywallPollExpiry        int64  // After this time, the user's paywall address will not be continuously polled
+	NewUserPaywallTxTime            int64  `json:",omitempty"` // Unix timestamp of when the paywall payment was recorded
 	NewUserVerificationToken        []byte // Verification token during signup
 	NewUserVerificationExpiry       int64  // Verification expiration
 	UpdateKeyVerificationToken      []byte // Verification token for updating keypair
@@ -107,6 +180,22 @@ type User struct {
 	ResetPasswordVerificationExpiry int64  // Reset password token expiration
 	LastLoginTime                   int64  // Unix timestamp of when the user last logged in
 	FailedLoginAttempts             uint64 // Number of failed login a user has made in a row
+	Deactivated                     bool   `json:",omitempty"` // Whether the account was deactivated by an admin
+
+	// Lockout metadata, see LockoutPolicy.  The fields are omitted when
+	// they are not set so that the encoding of existing records doesn't
+	// change.
+	LockedUntil int64  `json:",omitempty"` // Unix timestamp of when the lock expires, 0 if it doesn't
+	LockReason  string `json:",omitempty"` // Why the user was locked
+
+	// Two-factor authentication settings, nil if the user has not
+	// enrolled.  See EnrollTOTP.
+	TOTP *TOTP `json:",omitempty"`
+
+	// Pending email change, see StartEmailChange.
+	NewEmail                      string `json:",omitempty"` // Requested email address
+	EmailChangeVerificationToken  []byte `json:",omitempty"` // Token sent to the new address
+	EmailChangeVerificationExpiry int64  `json:",omitempty"` // Token expiration
 
 	// All identities the user has ever used.  User should only have one
 	// active key at a time.  We allow multiples in order to deal with key
@@ -131,6 +220,110 @@ type User struct {
 	SpentProposalCredits []ProposalCredit
 }
 
+// Delivery settings of the notifications in UserPreferences.
+const (
+	NotifyNever     = "never"     // Don't send the notification
+	NotifyImmediate = "immediate" // Send an email for every event
+	NotifyDigest    = "digest"    // Include the events in a periodic digest
+)
+
+// UserPreferences holds the settings of a user that politeiawww doesn't need
+// to authenticate the user.  They are stored in their own record so that the
+// user record, which is read on every request, stays small.
+type UserPreferences struct {
+	UserID        uint64            // ID of the user
+	Notifications map[string]string // Delivery of each notification type, e.g. NotifyDigest
+	Language      string            // Language tag, e.g. en-US
+	UI            map[string]string // Settings of the web interface
+	Updated       int64             // Unix timestamp of the last update
+}
+
+// Invitation allows registration while registration is invite-only.  Only
+// the hash of the invite token is stored, see NewInvitation.
+type Invitation struct {
+	TokenHash  []byte // SHA256 hash of the invite token
+	Email      string // Email the invitation was sent to
+	InviterID  uint64 // ID of the admin that created the invitation
+	CreatedAt  int64  // Unix timestamp of when the invitation was created
+	Expiry     int64  // Unix timestamp of when the invitation expires
+	RedeemedBy uint64 // ID of the user that registered with the invitation
+	RedeemedAt int64  // Unix timestamp of the registration, 0 if unused
+}
+
+// Session is a web server session.  The session values are stored in the
+// encoded form produced by the session store.
+type Session struct {
+	ID        string // Unique session ID
+	UserID    uint64 // ID of the user the session belongs to, if any
+	Values    string // Encoded session values
+	CreatedAt int64  // Unix timestamp of when the session was created
+	Expiry    int64  // Unix timestamp of when the session expires
+}
+
+const (
+	// EmailMaxAttempts is the number of delivery attempts after which a
+	// queued email is no longer retried.  It stays in the queue so that it
+	// can be inspected.
+	EmailMaxAttempts = 10
+
+	// EmailClaimDuration is the amount of time a claimed email is reserved
+	// for the claimant before it can be claimed again.
+	EmailClaimDuration = 5 * time.Minute
+
+	// emailRetryBackoff is the delay before the first retry.  It doubles with
+	// every failed attempt.
+	emailRetryBackoff = time.Minute
+)
+
+// QueuedEmail is an email that is waiting to be delivered.
+type QueuedEmail struct {
+	ID          uint64   // Unique id
+	To          []string // Recipients
+	BCC         []string // Blind carbon copy recipients
+	Subject     string   // Email subject
+	Body        string   // HTML email body
+	CreatedAt   int64    // Unix timestamp of when the email was queued
+	Attempts    uint32   // Number of failed delivery attempts
+	LastError   string   // Error of the last failed delivery attempt
+	NextAttempt int64    // Unix timestamp before which the email is not delivered
+	ClaimExpiry int64    // Unix timestamp until which the email is claimed
+}
+
+// IsFailed returns true if the email has reached the maximum number of
+// delivery attempts.
+func (e *QueuedEmail) IsFailed() bool {
+	return e.Attempts >= EmailMaxAttempts
+}
+
+// EmailRetryDelay returns the amount of time to wait before the next
+// delivery attempt of an email that has failed the given number of times.
+func EmailRetryDelay(attempts uint32) time.Duration {
+	if attempts == 0 {
+		return 0
+	}
+	return emailRetryBackoff << (attempts - 1)
+}
+
+// UserHistoryEntry is a previous version of a user record.  Updates that
+// only change login and paywall polling bookkeeping don't create an entry,
+// and the password hash, verification tokens and two-factor secrets are not
+// retained.
+type UserHistoryEntry struct {
+	Version   uint64 // Increases with every update of the user
+	Timestamp int64  // Unix timestamp of when the version was replaced
+	User      User   // User record as it was before the update
+}
+
+// AuditEntry records a single administrative change to the database.
+type AuditEntry struct {
+	ID        uint64 // Unique id
+	Actor     string // Who made the change
+	Action    string // Name of the action, e.g. setadmin
+	Target    string // Email of the user that was changed, if any
+	Timestamp int64  // Unix timestamp of the change
+	Diff      string // Human readable description of what changed
+}
+
 // Database interface that is required by the web server.
 type Database interface {
 	// User functions
@@ -141,6 +334,64 @@ type Database interface {
 	UserUpdate(User) error                   // Update existing user
 	AllUsers(callbackFn func(u *User)) error // Iterate all users
 
+	// UserChangeEmail changes the email, and therefore the lookup key, of an
+	// existing user.  It returns ErrUserExists if the new email is already
+	// in use.
+	UserChangeEmail(oldEmail, newEmail string) error
+
+	// UserHistory returns the retained previous versions of a user record,
+	// most recent first.
+	UserHistory(email string) ([]UserHistoryEntry, error)
+
+	// UserUpdateOnce updates an existing user unless an update with the
+	// same operation ID has already been applied, in which case it returns
+	// ErrDuplicateOperation.  Operation IDs are only retained for a limited
+	// amount of time; they protect against retries, not replays.
+	UserUpdateOnce(opID string, u User) error
+
+	// User preferences functions
+	UserPreferencesGet(userID uint64) (*UserPreferences, error) // Return preferences of a user
+	UserPreferencesSave(UserPreferences) error                  // Create or update preferences
+
+	// Invitation functions
+	InviteNew(Invitation) error                      // Add invitation
+	InviteGet(token []byte) (*Invitation, error)     // Return invitation if it can be redeemed
+	InviteRedeem(token []byte, userID uint64) error  // Mark invitation as used by the user
+	AllInvites(callbackFn func(i *Invitation)) error // Iterate all invitations
+
+	// Session functions
+	SessionSave(Session) error               // Create or update a session
+	SessionGetByID(string) (*Session, error) // Return unexpired session
+	SessionDeleteByID(string) error          // Delete a session
+	SessionsDeleteByUserID(uint64) error     // Delete all sessions of a user
+
+	// Email queue functions
+	EmailEnqueue(QueuedEmail) (uint64, error)              // Add email to the queue, returns its id
+	EmailClaim() (*QueuedEmail, error)                     // Claim the next email that is due
+	EmailMarkSent(uint64) error                            // Remove delivered email from the queue
+	EmailRetry(id uint64, sendErr error) error             // Record failed delivery attempt
+	EmailDelete(uint64) error                              // Remove email from the queue
+	AllQueuedEmails(callbackFn func(e *QueuedEmail)) error // Iterate all queued emails
+
+	// Audit log functions
+	AuditLogAppend(AuditEntry) error // Add entry to the audit log
+
+	// AuditLog iterates the audit log entries with a timestamp within
+	// [since, until) in the order they were added.  An until of zero means
+	// no upper bound.
+	AuditLog(since, until int64, callbackFn func(a *AuditEntry)) error
+
+	// Increment atomically increments the counter stored under the given
+	// key and returns its new value.  A counter that does not exist yet
+	// starts above the last allocated user ID so that the indexes it hands
+	// out never collide with indexes that were derived from user IDs.
+	Increment(key string) (uint64, error)
+
+	// VerifyIntegrity checks every record in the database.  The callback
+	// is invoked once per record with a nil error if the record is valid or
+	// with the reason the record failed verification.
+	VerifyIntegrity(callbackFn func(key string, err error)) error
+
 	// Close performs cleanup of the backend.
 	Close() error
 }
@@ -0,0 +1,80 @@
+// Copyright (c) 2017 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"crypto/subtle"
+	"strings"
+	"time"
+
+	"github.com/badoux/checkmail"
+)
+
+// An email change takes two steps because the email is the lookup key of the
+// user record:
+//
+//   1. StartEmailChange records the requested address along with a
+//      verification token.  The caller stores the user, notifies the old
+//      address and sends the token to the new address.
+//   2. ConfirmEmailChange checks the token and moves the user record to the
+//      new address.
+//
+// Until the change is confirmed the user keeps logging in with the old
+// address.
+
+// StartEmailChange records a pending change of the user's email to newEmail
+// that is confirmed with token until expiry.  A pending change is replaced.
+// It returns ErrUserExists if newEmail is the current email; whether another
+// user has it is checked by the caller and again on confirmation.  The
+// caller must store the user.
+func StartEmailChange(u *User, newEmail string, token []byte, expiry int64) error {
+	newEmail = strings.ToLower(strings.TrimSpace(newEmail))
+	if err := checkmail.ValidateFormat(newEmail); err != nil {
+		return ErrInvalidEmail
+	}
+	if newEmail == u.Email {
+		return ErrUserExists
+	}
+
+	u.NewEmail = newEmail
+	u.EmailChangeVerificationToken = token
+	u.EmailChangeVerificationExpiry = expiry
+	return nil
+}
+
+// CancelEmailChange removes the pending email change of the user.  The
+// caller must store the user.
+func CancelEmailChange(u *User) {
+	u.NewEmail = ""
+	u.EmailChangeVerificationToken = nil
+	u.EmailChangeVerificationExpiry = 0
+}
+
+// ConfirmEmailChange checks token against the pending email change of the
+// user and moves the user record to the new email.  u is updated to the
+// stored record.  An expired change is kept so that the caller can tell the
+// user; it is replaced by the next StartEmailChange.
+func ConfirmEmailChange(db Database, u *User, token []byte, now time.Time) error {
+	if u.NewEmail == "" || u.EmailChangeVerificationToken == nil {
+		return ErrEmailChangeNotFound
+	}
+	if subtle.ConstantTimeCompare(token, u.EmailChangeVerificationToken) != 1 {
+		return ErrEmailChangeTokenInvalid
+	}
+	if now.Unix() > u.EmailChangeVerificationExpiry {
+		return ErrEmailChangeTokenExpired
+	}
+
+	// Move the record first; the pending change is only cleared once the
+	// new email is known to be free.
+	oldEmail, newEmail := u.Email, u.NewEmail
+	if err := db.UserChangeEmail(oldEmail, newEmail); err != nil {
+		return err
+	}
+
+	u.Email = newEmail
+	CancelEmailChange(u)
+	return db.UserUpdate(*u)
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2017 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Error is returned by database backends when an operation fails because of
+// the underlying store, e.g. an I/O error or a record that can't be decoded.
+// The Err values above are returned as is and are never wrapped.
+type Error struct {
+	Backend string // Database backend, e.g. leveldb
+	Op      string // Database interface method that failed
+	Key     string // Hash of the record key, empty if there is none
+	Err     error  // Underlying error
+}
+
+// Error satisfies the error interface.
+func (e *Error) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("%v %v: %v", e.Backend, e.Op, e.Err)
+	}
+	return fmt.Sprintf("%v %v %v: %v", e.Backend, e.Op, e.Key, e.Err)
+}
+
+// HashKey returns the representation of a record key that is used in errors.
+// Keys contain emails and session IDs which must not end up in logs.
+func HashKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:8])
+}
+
+// isDatabaseErr returns whether err is one of the Err values above.
+func isDatabaseErr(err error) bool {
+	switch err {
+	case ErrUserNotFound, ErrUserExists, ErrInvalidEmail, ErrShutdown,
+		ErrSessionNotFound, ErrEmailQueueEmpty, ErrEmailNotFound,
+		ErrChecksumMissing, ErrChecksumMismatch, ErrDuplicateOperation,
+		ErrUnknownRecord, ErrTOTPNotEnrolled, ErrTOTPEnrolled,
+		ErrEmailChangeNotFound, ErrEmailChangeTokenInvalid,
+		ErrEmailChangeTokenExpired, ErrPreferencesNotFound,
+		ErrInviteNotFound, ErrInviteExpired, ErrInviteRedeemed,
+		ErrWrongVersion:
+		return true
+	}
+	return false
+}
+
+// WrapError wraps an error of the underlying store of a backend into an
+// Error.  nil, the Err values above and errors that are already wrapped are
+// returned unchanged so that callers can keep comparing against the Err
+// values.
+func WrapError(backend, op, key string, err error) error {
+	if err == nil || isDatabaseErr(err) {
+		return err
+	}
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+
+	return &Error{
+		Backend: backend,
+		Op:      op,
+		Key:     HashKey(key),
+		Err:     err,
+	}
+}
+
+// Cause returns the underlying error of an Error, or err itself.
+func Cause(err error) error {
+	if e, ok := err.(*Error); ok {
+		return e.Err
+	}
+	return err
+}
+
+// IsNotFound returns whether err indicates that a record doesn't exist.
+func IsNotFound(err error) bool {
+	switch Cause(err) {
+	case ErrUserNotFound, ErrSessionNotFound, ErrEmailNotFound,
+		ErrPreferencesNotFound, ErrInviteNotFound, ErrEmailChangeNotFound,
+		ErrTOTPNotEnrolled:
+		return true
+	}
+	return false
+}
+
+// IsExists returns whether err indicates that a record or operation already
+// exists.
+func IsExists(err error) bool {
+	switch Cause(err) {
+	case ErrUserExists, ErrDuplicateOperation:
+		return true
+	}
+	return false
+}
+
+// IsCorrupt returns whether err indicates that a record failed its integrity
+// checks.
+func IsCorrupt(err error) bool {
+	switch Cause(err) {
+	case ErrChecksumMissing, ErrChecksumMismatch, ErrUnknownRecord:
+		return true
+	}
+	return false
+}
+
+// IsShutdown returns whether err indicates that the database is shutting
+// down.
+func IsShutdown(err error) bool {
+	return Cause(err) == ErrShutdown
+}
+
+// IsBackend returns whether err is an error of the underlying store rather
+// than one of the Err values above.
+func IsBackend(err error) bool {
+	_, ok := err.(*Error)
+	return ok
+}
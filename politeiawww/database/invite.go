@@ -0,0 +1,63 @@
+// Copyright (c) 2017 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"strings"
+	"time"
+
+	"github.com/badoux/checkmail"
+)
+
+const (
+	// InviteTokenSize is the size of an invite token in bytes.
+	InviteTokenSize = 32
+
+	// InviteExpiry is the amount of time an invitation can be redeemed.
+	InviteExpiry = 7 * 24 * time.Hour
+)
+
+// HashInviteToken returns the hash under which an invitation is stored.
+func HashInviteToken(token []byte) []byte {
+	h := sha256.Sum256(token)
+	return h[:]
+}
+
+// NewInvitation creates an invitation for the email and returns it along with
+// the invite token, which has to be sent to the invitee since only its hash
+// is stored.  The caller must store the invitation with InviteNew.
+func NewInvitation(email string, inviterID uint64, now time.Time) ([]byte, *Invitation, error) {
+	email = strings.ToLower(email)
+	if err := checkmail.ValidateFormat(email); err != nil {
+		return nil, nil, ErrInvalidEmail
+	}
+
+	token := make([]byte, InviteTokenSize)
+	if _, err := rand.Read(token); err != nil {
+		return nil, nil, err
+	}
+
+	return token, &Invitation{
+		TokenHash: HashInviteToken(token),
+		Email:     email,
+		InviterID: inviterID,
+		CreatedAt: now.Unix(),
+		Expiry:    now.Add(InviteExpiry).Unix(),
+	}, nil
+}
+
+// CheckInvitation returns nil if the invitation can be redeemed at the given
+// time, ErrInviteRedeemed or ErrInviteExpired otherwise.
+func CheckInvitation(i *Invitation, now time.Time) error {
+	if i.RedeemedAt != 0 {
+		return ErrInviteRedeemed
+	}
+	if now.Unix() >= i.Expiry {
+		return ErrInviteExpired
+	}
+	return nil
+}
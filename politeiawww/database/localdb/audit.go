@@ -0,0 +1,80 @@
+package localdb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/decred/politeia/politeiawww/database"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// auditKey returns the key of an audit log entry.  The ID is zero padded so
+// that entries are iterated in the order they were added.
+func auditKey(id uint64) []byte {
+	return []byte(fmt.Sprintf("%v%016x", AuditPrefix, id))
+}
+
+// AuditLogAppend adds an entry to the audit log.  The entry ID is assigned by
+// the database and the timestamp is set if the caller did not provide one.
+//
+// AuditLogAppend satisfies the backend interface.
+func (l *localdb) AuditLogAppend(a database.AuditEntry) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return database.ErrShutdown
+	}
+
+	log.Debugf("AuditLogAppend: %v %v %v", a.Actor, a.Action, a.Target)
+
+	id, err := l.increment([]byte(LastAuditIdKey))
+	if err != nil {
+		return wrapErr("AuditLogAppend", "", err)
+	}
+
+	a.ID = id
+	if a.Timestamp == 0 {
+		a.Timestamp = time.Now().Unix()
+	}
+
+	payload, err := EncodeAuditEntry(a)
+	if err != nil {
+		return wrapErr("AuditLogAppend", "", err)
+	}
+
+	return wrapErr("AuditLogAppend", "", l.userdb.Put(auditKey(id), payload, nil))
+}
+
+// AuditLog iterates the audit log entries that fall within the given time
+// range.
+//
+// AuditLog satisfies the backend interface.
+func (l *localdb) AuditLog(since, until int64, callbackFn func(a *database.AuditEntry)) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return database.ErrShutdown
+	}
+
+	log.Debugf("AuditLog: %v %v", since, until)
+
+	iter := l.userdb.NewIterator(util.BytesPrefix([]byte(AuditPrefix)), nil)
+	for iter.Next() {
+		a, err := DecodeAuditEntry(iter.Value())
+		if err != nil {
+			iter.Release()
+			return wrapErr("AuditLog", "", err)
+		}
+
+		if a.Timestamp < since || (until != 0 && a.Timestamp >= until) {
+			continue
+		}
+
+		callbackFn(a)
+	}
+	iter.Release()
+
+	return wrapErr("AuditLog", "", iter.Error())
+}
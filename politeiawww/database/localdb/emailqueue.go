@@ -0,0 +1,219 @@
+package localdb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/decred/politeia/politeiawww/database"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// emailKey returns the key of a queued email.  The ID is zero padded so that
+// emails are iterated in the order they were queued.
+func emailKey(id uint64) []byte {
+	return []byte(fmt.Sprintf("%v%016x", EmailQueuePrefix, id))
+}
+
+// getQueuedEmail returns the queued email with the given ID.
+//
+// This function must be called with the lock held.
+func (l *localdb) getQueuedEmail(id uint64) (*database.QueuedEmail, error) {
+	payload, err := l.userdb.Get(emailKey(id), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, database.ErrEmailNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return DecodeQueuedEmail(payload)
+}
+
+// putQueuedEmail writes the queued email to the database.
+//
+// This function must be called with the lock held.
+func (l *localdb) putQueuedEmail(e database.QueuedEmail) error {
+	payload, err := EncodeQueuedEmail(e)
+	if err != nil {
+		return err
+	}
+
+	return l.userdb.Put(emailKey(e.ID), payload, nil)
+}
+
+// EmailEnqueue adds an email to the queue and returns its ID.
+//
+// EmailEnqueue satisfies the backend interface.
+func (l *localdb) EmailEnqueue(e database.QueuedEmail) (uint64, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return 0, database.ErrShutdown
+	}
+
+	log.Debugf("EmailEnqueue: %v %v", e.To, e.Subject)
+
+	id, err := l.increment([]byte(LastEmailIdKey))
+	if err != nil {
+		return 0, wrapErr("EmailEnqueue", "", err)
+	}
+
+	e.ID = id
+	e.CreatedAt = time.Now().Unix()
+	e.Attempts = 0
+	e.LastError = ""
+	e.NextAttempt = 0
+	e.ClaimExpiry = 0
+
+	return id, wrapErr("EmailEnqueue", "", l.putQueuedEmail(e))
+}
+
+// EmailClaim claims the oldest queued email that is due for delivery.  The
+// email is reserved for database.EmailClaimDuration; if it is neither marked
+// as sent nor retried in that time it can be claimed again.
+//
+// EmailClaim satisfies the backend interface.
+func (l *localdb) EmailClaim() (*database.QueuedEmail, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return nil, database.ErrShutdown
+	}
+
+	log.Tracef("EmailClaim")
+
+	now := time.Now()
+	var claimed *database.QueuedEmail
+	iter := l.userdb.NewIterator(util.BytesPrefix([]byte(EmailQueuePrefix)), nil)
+	for iter.Next() {
+		e, err := DecodeQueuedEmail(iter.Value())
+		if err != nil {
+			iter.Release()
+			return nil, wrapErr("EmailClaim", "", err)
+		}
+
+		if e.IsFailed() || e.NextAttempt > now.Unix() ||
+			e.ClaimExpiry > now.Unix() {
+			continue
+		}
+
+		claimed = e
+		break
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return nil, wrapErr("EmailClaim", "", err)
+	}
+
+	if claimed == nil {
+		return nil, database.ErrEmailQueueEmpty
+	}
+
+	claimed.ClaimExpiry = now.Add(database.EmailClaimDuration).Unix()
+	err := l.putQueuedEmail(*claimed)
+	if err != nil {
+		return nil, wrapErr("EmailClaim", "", err)
+	}
+
+	return claimed, nil
+}
+
+// EmailMarkSent removes a delivered email from the queue.
+//
+// EmailMarkSent satisfies the backend interface.
+func (l *localdb) EmailMarkSent(id uint64) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return database.ErrShutdown
+	}
+
+	log.Debugf("EmailMarkSent: %v", id)
+
+	err := l.userdb.Delete(emailKey(id), nil)
+	return wrapErr("EmailMarkSent", string(emailKey(id)), err)
+}
+
+// EmailRetry records a failed delivery attempt and schedules the next
+// attempt using an exponential backoff.
+//
+// EmailRetry satisfies the backend interface.
+func (l *localdb) EmailRetry(id uint64, sendErr error) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return database.ErrShutdown
+	}
+
+	log.Debugf("EmailRetry: %v %v", id, sendErr)
+
+	e, err := l.getQueuedEmail(id)
+	if err != nil {
+		return wrapErr("EmailRetry", string(emailKey(id)), err)
+	}
+
+	e.Attempts++
+	if sendErr != nil {
+		e.LastError = sendErr.Error()
+	}
+	e.NextAttempt = time.Now().Add(database.EmailRetryDelay(e.Attempts)).Unix()
+	e.ClaimExpiry = 0
+
+	return wrapErr("EmailRetry", string(emailKey(id)), l.putQueuedEmail(*e))
+}
+
+// EmailDelete removes an email from the queue regardless of its state.
+//
+// EmailDelete satisfies the backend interface.
+func (l *localdb) EmailDelete(id uint64) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return database.ErrShutdown
+	}
+
+	log.Debugf("EmailDelete: %v", id)
+
+	exists, err := l.userdb.Has(emailKey(id), nil)
+	if err != nil {
+		return wrapErr("EmailDelete", string(emailKey(id)), err)
+	} else if !exists {
+		return database.ErrEmailNotFound
+	}
+
+	err = l.userdb.Delete(emailKey(id), nil)
+	return wrapErr("EmailDelete", string(emailKey(id)), err)
+}
+
+// AllQueuedEmails iterates all queued emails in the order they were queued.
+//
+// AllQueuedEmails satisfies the backend interface.
+func (l *localdb) AllQueuedEmails(callbackFn func(e *database.QueuedEmail)) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return database.ErrShutdown
+	}
+
+	log.Debugf("AllQueuedEmails")
+
+	iter := l.userdb.NewIterator(util.BytesPrefix([]byte(EmailQueuePrefix)), nil)
+	for iter.Next() {
+		e, err := DecodeQueuedEmail(iter.Value())
+		if err != nil {
+			iter.Release()
+			return wrapErr("AllQueuedEmails", "", err)
+		}
+
+		callbackFn(e)
+	}
+	iter.Release()
+
+	return wrapErr("AllQueuedEmails", "", iter.Error())
+}
@@ -1,7 +1,9 @@
 package localdb
 
 import (
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"path/filepath"
 	"time"
 
@@ -32,7 +34,8 @@ func DecodeVersion(payload []byte) (*Version, error) {
 }
 
 // openUserDB opens the user database and writes out the version record if
-// needed.
+// needed.  Databases of an older version are upgraded and databases of a
+// newer version are rejected with ErrWrongVersion.
 func (l *localdb) openUserDB(path string) error {
 	// open database
 	var err error
@@ -41,21 +44,87 @@ func (l *localdb) openUserDB(path string) error {
 		return err
 	}
 
+	err = l.checkVersion()
+	if err != nil {
+		l.userdb.Close()
+		return err
+	}
+	return nil
+}
+
+// checkVersion writes the version record if there is none and upgrades the
+// database if it is of an older version.
+func (l *localdb) checkVersion() error {
 	// See if we need to write a version record
-	exists, err := l.userdb.Has([]byte(UserVersionKey), nil)
-	if err != nil || exists {
+	b, err := l.userdb.Get([]byte(UserVersionKey), nil)
+	if err == leveldb.ErrNotFound {
+		return SetVersion(l.userdb, UserVersion)
+	} else if err != nil {
 		return err
 	}
 
-	// Write version record
+	// A corrupt version record is left alone so that it is reported by
+	// VerifyIntegrity.
+	v, err := DecodeVersion(b)
+	if err != nil || v.Version == UserVersion {
+		return nil
+	}
+	if v.Version > UserVersion {
+		log.Errorf("User database version %v is newer than the "+
+			"supported version %v", v.Version, UserVersion)
+		return database.ErrWrongVersion
+	}
+
+	log.Infof("Upgrading user database from version %v to %v", v.Version,
+		UserVersion)
+	return SetVersion(l.userdb, UserVersion)
+}
+
+// SetVersion writes the version record of an open user database.  If the
+// version requires checksums, a checksum is added for every user record that
+// does not have one, which upgrades databases written before checksums were
+// introduced.
+func SetVersion(userdb *leveldb.DB, version uint32) error {
+	batch := new(leveldb.Batch)
+	if version >= ChecksumVersion {
+		iter := userdb.NewIterator(nil, nil)
+		for iter.Next() {
+			key := string(iter.Key())
+			if !IsUserRecord(key) {
+				continue
+			}
+			checksumKey := []byte(UserChecksumPrefix + key)
+			exists, err := userdb.Has(checksumKey, nil)
+			if err != nil {
+				iter.Release()
+				return err
+			}
+			if exists {
+				continue
+			}
+			checksum := sha256.Sum256(iter.Value())
+			batch.Put(checksumKey, checksum[:])
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+		if batch.Len() > 0 {
+			log.Infof("Adding %v missing user record checksums",
+				batch.Len())
+		}
+	}
+
 	v, err := EncodeVersion(Version{
-		Version: UserVersion,
+		Version: version,
 		Time:    time.Now().Unix(),
 	})
 	if err != nil {
 		return err
 	}
-	return l.userdb.Put([]byte(UserVersionKey), v, nil)
+	batch.Put([]byte(UserVersionKey), v)
+
+	return userdb.Write(batch, nil)
 }
 
 // EncodeUser encodes User into a JSON byte slice.
@@ -79,3 +148,153 @@ func DecodeUser(payload []byte) (*database.User, error) {
 
 	return &u, nil
 }
+
+// EncodeSession encodes Session into a JSON byte slice.
+func EncodeSession(s database.Session) ([]byte, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// DecodeSession decodes a JSON byte slice into a Session.
+func DecodeSession(payload []byte) (*database.Session, error) {
+	var s database.Session
+
+	err := json.Unmarshal(payload, &s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// EncodeQueuedEmail encodes QueuedEmail into a JSON byte slice.
+func EncodeQueuedEmail(e database.QueuedEmail) ([]byte, error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// DecodeQueuedEmail decodes a JSON byte slice into a QueuedEmail.
+func DecodeQueuedEmail(payload []byte) (*database.QueuedEmail, error) {
+	var e database.QueuedEmail
+
+	err := json.Unmarshal(payload, &e)
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// EncodeAuditEntry encodes AuditEntry into a JSON byte slice.
+func EncodeAuditEntry(a database.AuditEntry) ([]byte, error) {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// DecodeAuditEntry decodes a JSON byte slice into an AuditEntry.
+func DecodeAuditEntry(payload []byte) (*database.AuditEntry, error) {
+	var a database.AuditEntry
+
+	err := json.Unmarshal(payload, &a)
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// EncodeUserHistoryEntry encodes UserHistoryEntry into a JSON byte slice.
+func EncodeUserHistoryEntry(h database.UserHistoryEntry) ([]byte, error) {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// DecodeUserHistoryEntry decodes a JSON byte slice into a UserHistoryEntry.
+func DecodeUserHistoryEntry(payload []byte) (*database.UserHistoryEntry, error) {
+	var h database.UserHistoryEntry
+
+	err := json.Unmarshal(payload, &h)
+	if err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
+
+// PreferencesVersion is the version of the user preferences encoding.
+const PreferencesVersion uint32 = 1
+
+// preferencesEnvelope is the stored form of the user preferences.  The
+// version allows the preferences to change independently of the user
+// record.
+type preferencesEnvelope struct {
+	Version     uint32                   `json:"version"`
+	Preferences database.UserPreferences `json:"preferences"`
+}
+
+// EncodeUserPreferences encodes UserPreferences into a JSON byte slice.
+func EncodeUserPreferences(p database.UserPreferences) ([]byte, error) {
+	b, err := json.Marshal(preferencesEnvelope{
+		Version:     PreferencesVersion,
+		Preferences: p,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// DecodeUserPreferences decodes a JSON byte slice into UserPreferences.
+func DecodeUserPreferences(payload []byte) (*database.UserPreferences, error) {
+	var e preferencesEnvelope
+
+	err := json.Unmarshal(payload, &e)
+	if err != nil {
+		return nil, err
+	}
+	if e.Version != PreferencesVersion {
+		return nil, fmt.Errorf("unsupported preferences version %v",
+			e.Version)
+	}
+
+	return &e.Preferences, nil
+}
+
+// EncodeInvitation encodes Invitation into a JSON byte slice.
+func EncodeInvitation(i database.Invitation) ([]byte, error) {
+	b, err := json.Marshal(i)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// DecodeInvitation decodes a JSON byte slice into an Invitation.
+func DecodeInvitation(payload []byte) (*database.Invitation, error) {
+	var i database.Invitation
+
+	err := json.Unmarshal(payload, &i)
+	if err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
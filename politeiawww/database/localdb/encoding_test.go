@@ -0,0 +1,417 @@
+package localdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/decred/politeia/politeiawww/database"
+)
+
+// userVectors are user records as they are stored by each database version.
+// A new database version must add a vector so that records written by older
+// versions keep decoding.
+var userVectors = map[uint32]string{
+	1: userVectorV1,
+	2: userVectorV1, // Adds checksums but keeps the record encoding
+}
+
+// userVectorV1 is a user record as stored by the first database version.
+const userVectorV1 = `{"ID":7,"Email":"user@example.com","Username":"user","HashedPassword":"aGFzaA==","Admin":true,"NewUserPaywallAddress":"Tsaddress","NewUserPaywallAmount":10000000,"NewUserPaywallTx":"txid","NewUserPaywallTxNotBefore":1530000000,"NewUserPaywallPollExpiry":1530086400,"NewUserVerificationToken":"AQID","NewUserVerificationExpiry":1530000100,"UpdateKeyVerificationToken":"BAUG","UpdateKeyVerificationExpiry":1530000200,"ResetPasswordVerificationToken":"BwgJ","ResetPasswordVerificationExpiry":1530000300,"LastLoginTime":1530000400,"FailedLoginAttempts":2,"Identities":[{"Key":[0,1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20,21,22,23,24,25,26,27,28,29,30,31],"Activated":1530000500,"Deactivated":0}],"ProposalPaywalls":[{"ID":1,"CreditPrice":1000000,"Address":"Tspaywall","TxNotBefore":1530000600,"PollExpiry":1530086400,"TxID":"paywalltx","TxAmount":2000000,"NumCredits":2}],"UnspentProposalCredits":[{"PaywallID":1,"Price":1000000,"DatePurchased":1530000700,"TxID":"paywalltx","CensorshipToken":""}],"SpentProposalCredits":[{"PaywallID":1,"Price":1000000,"DatePurchased":1530000700,"TxID":"paywalltx","CensorshipToken":"token"}]}`
+
+// baselineUser is the user record of the first database version.  It is
+// used to check that the version 1 vector is exactly what that version
+// wrote.
+type baselineUser struct {
+	ID                              uint64
+	Email                           string
+	Username                        string
+	HashedPassword                  []byte
+	Admin                           bool
+	NewUserPaywallAddress           string
+	NewUserPaywallAmount            uint64
+	NewUserPaywallTx                string
+	NewUserPaywallTxNotBefore       int64
+	NewUserPaywallPollExpiry        int64
+	NewUserVerificationToken        []byte
+	NewUserVerificationExpiry       int64
+	UpdateKeyVerificationToken      []byte
+	UpdateKeyVerificationExpiry     int64
+	ResetPasswordVerificationToken  []byte
+	ResetPasswordVerificationExpiry int64
+	LastLoginTime                   int64
+	FailedLoginAttempts             uint64
+	Identities                      []struct {
+		Key         [32]byte
+		Activated   int64
+		Deactivated int64
+	}
+	ProposalPaywalls []struct {
+		ID          uint64
+		CreditPrice uint64
+		Address     string
+		TxNotBefore int64
+		PollExpiry  int64
+		TxID        string
+		TxAmount    uint64
+		NumCredits  uint64
+	}
+	UnspentProposalCredits []baselineCredit
+	SpentProposalCredits   []baselineCredit
+}
+
+type baselineCredit struct {
+	PaywallID       uint64
+	Price           uint64
+	DatePurchased   int64
+	TxID            string
+	CensorshipToken string
+}
+
+// vectorUser is the user that every entry of userVectors decodes to.
+func vectorUser() database.User {
+	var key [32]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+
+	return database.User{
+		ID:                              7,
+		Email:                           "user@example.com",
+		Username:                        "user",
+		HashedPassword:                  []byte("hash"),
+		Admin:                           true,
+		NewUserPaywallAddress:           "Tsaddress",
+		NewUserPaywallAmount:            10000000,
+		NewUserPaywallTx:                "txid",
+		NewUserPaywallTxNotBefore:       1530000000,
+		NewUserPaywallPollExpiry:        1530086400,
+		NewUserVerificationToken:        []byte{1, 2, 3},
+		NewUserVerificationExpiry:       1530000100,
+		UpdateKeyVerificationToken:      []byte{4, 5, 6},
+		UpdateKeyVerificationExpiry:     1530000200,
+		ResetPasswordVerificationToken:  []byte{7, 8, 9},
+		ResetPasswordVerificationExpiry: 1530000300,
+		LastLoginTime:                   1530000400,
+		FailedLoginAttempts:             2,
+		Identities: []database.Identity{{
+			Key:       key,
+			Activated: 1530000500,
+		}},
+		ProposalPaywalls: []database.ProposalPaywall{{
+			ID:          1,
+			CreditPrice: 1000000,
+			Address:     "Tspaywall",
+			TxNotBefore: 1530000600,
+			PollExpiry:  1530086400,
+			TxID:        "paywalltx",
+			TxAmount:    2000000,
+			NumCredits:  2,
+		}},
+		UnspentProposalCredits: []database.ProposalCredit{{
+			PaywallID:     1,
+			Price:         1000000,
+			DatePurchased: 1530000700,
+			TxID:          "paywalltx",
+		}},
+		SpentProposalCredits: []database.ProposalCredit{{
+			PaywallID:       1,
+			Price:           1000000,
+			DatePurchased:   1530000700,
+			TxID:            "paywalltx",
+			CensorshipToken: "token",
+		}},
+	}
+}
+
+// randomBytes returns nil or a random byte slice.
+func randomBytes(r *rand.Rand) []byte {
+	if r.Intn(4) == 0 {
+		return nil
+	}
+	b := make([]byte, r.Intn(64))
+	r.Read(b)
+	return b
+}
+
+// randomString returns a random string that includes characters that must
+// be escaped in JSON.
+func randomString(r *rand.Rand) string {
+	const chars = "abcXYZ019 @._-\"\\/\n\t<>&é世\U0001f600"
+	runes := []rune(chars)
+	s := make([]rune, r.Intn(32))
+	for i := range s {
+		s[i] = runes[r.Intn(len(runes))]
+	}
+	return string(s)
+}
+
+func randomCredits(r *rand.Rand) []database.ProposalCredit {
+	if r.Intn(4) == 0 {
+		return nil
+	}
+	credits := make([]database.ProposalCredit, r.Intn(4))
+	for i := range credits {
+		credits[i] = database.ProposalCredit{
+			PaywallID:       r.Uint64(),
+			Price:           r.Uint64(),
+			DatePurchased:   r.Int63() - r.Int63(),
+			TxID:            randomString(r),
+			CensorshipToken: randomString(r),
+		}
+	}
+	return credits
+}
+
+// randomUser returns a user with every field set to a random value.
+func randomUser(r *rand.Rand) database.User {
+	u := database.User{
+		ID:                              r.Uint64(),
+		Email:                           randomString(r),
+		Username:                        randomString(r),
+		HashedPassword:                  randomBytes(r),
+		Admin:                           r.Intn(2) == 0,
+		NewUserPaywallAddress:           randomString(r),
+		NewUserPaywallAmount:            r.Uint64(),
+		NewUserPaywallTx:                randomString(r),
+		NewUserPaywallTxNotBefore:       r.Int63() - r.Int63(),
+		NewUserPaywallPollExpiry:        r.Int63() - r.Int63(),
+		NewUserPaywallTxTime:            r.Int63() - r.Int63(),
+		NewUserVerificationToken:        randomBytes(r),
+		NewUserVerificationExpiry:       r.Int63() - r.Int63(),
+		UpdateKeyVerificationToken:      randomBytes(r),
+		UpdateKeyVerificationExpiry:     r.Int63() - r.Int63(),
+		ResetPasswordVerificationToken:  randomBytes(r),
+		ResetPasswordVerificationExpiry: r.Int63() - r.Int63(),
+		LastLoginTime:                   r.Int63() - r.Int63(),
+		FailedLoginAttempts:             r.Uint64(),
+		Deactivated:                     r.Intn(2) == 0,
+		LockedUntil:                     r.Int63() - r.Int63(),
+		LockReason:                      randomString(r),
+		NewEmail:                        randomString(r),
+		EmailChangeVerificationToken:    randomBytes(r),
+		EmailChangeVerificationExpiry:   r.Int63() - r.Int63(),
+		UnspentProposalCredits:          randomCredits(r),
+		SpentProposalCredits:            randomCredits(r),
+	}
+
+	if r.Intn(2) == 0 {
+		u.TOTP = &database.TOTP{
+			Secret:        randomBytes(r),
+			Confirmed:     r.Intn(2) == 0,
+			RecoveryCodes: [][]byte{randomBytes(r), randomBytes(r)},
+			LastStep:      r.Int63(),
+			Enrolled:      r.Int63(),
+		}
+	}
+	for i := r.Intn(4); i > 0; i-- {
+		var id database.Identity
+		r.Read(id.Key[:])
+		id.Activated = r.Int63()
+		id.Deactivated = r.Int63()
+		u.Identities = append(u.Identities, id)
+	}
+	for i := r.Intn(4); i > 0; i-- {
+		u.ProposalPaywalls = append(u.ProposalPaywalls,
+			database.ProposalPaywall{
+				ID:          r.Uint64(),
+				CreditPrice: r.Uint64(),
+				Address:     randomString(r),
+				TxNotBefore: r.Int63() - r.Int63(),
+				PollExpiry:  r.Int63() - r.Int63(),
+				TxID:        randomString(r),
+				TxAmount:    r.Uint64(),
+				NumCredits:  r.Uint64(),
+			})
+	}
+
+	return u
+}
+
+func TestUserVectors(t *testing.T) {
+	if _, ok := userVectors[UserVersion]; !ok {
+		t.Fatalf("no user vector for database version %v", UserVersion)
+	}
+
+	expected := vectorUser()
+	for version, vector := range userVectors {
+		u, err := DecodeUser([]byte(vector))
+		if err != nil {
+			t.Fatalf("version %v: %v", version, err)
+		}
+		if !reflect.DeepEqual(*u, expected) {
+			t.Fatalf("version %v: got %+v, expected %+v", version, *u,
+				expected)
+		}
+	}
+
+	// The current version must encode to exactly its vector so that
+	// records don't change on disk without a version bump.
+	b, err := EncodeUser(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != userVectors[UserVersion] {
+		t.Fatalf("encoding changed:\ngot      %s\nexpected %s", b,
+			userVectors[UserVersion])
+	}
+}
+
+// TestBaselineVector verifies that the version 1 vector only contains what
+// the first database version stored, in the order it stored it.
+func TestBaselineVector(t *testing.T) {
+	var u baselineUser
+	err := json.Unmarshal([]byte(userVectors[1]), &u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != userVectors[1] {
+		t.Fatalf("not a baseline record:\ngot      %s\nexpected %s",
+			userVectors[1], b)
+	}
+}
+
+func TestVersionVector(t *testing.T) {
+	const vector = `{"version":1,"time":1530000000}`
+
+	v, err := DecodeVersion([]byte(vector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != 1 || v.Time != 1530000000 {
+		t.Fatalf("unexpected version %+v", v)
+	}
+
+	b, err := EncodeVersion(*v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != vector {
+		t.Fatalf("got %s, expected %s", b, vector)
+	}
+}
+
+func TestPreferencesVector(t *testing.T) {
+	const vector = `{"version":1,"preferences":{"UserID":7,"Notifications":{"proposalvote":"digest"},"Language":"en-US","UI":{"theme":"dark"},"Updated":1530000000}}`
+
+	p, err := DecodeUserPreferences([]byte(vector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := database.UserPreferences{
+		UserID: 7,
+		Notifications: map[string]string{
+			"proposalvote": database.NotifyDigest,
+		},
+		Language: "en-US",
+		UI:       map[string]string{"theme": "dark"},
+		Updated:  1530000000,
+	}
+	if !reflect.DeepEqual(*p, expected) {
+		t.Fatalf("got %+v, expected %+v", *p, expected)
+	}
+
+	b, err := EncodeUserPreferences(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != vector {
+		t.Fatalf("got %s, expected %s", b, vector)
+	}
+
+	// Other versions are rejected instead of being misread.
+	_, err = DecodeUserPreferences([]byte(`{"version":2,"preferences":{}}`))
+	if err == nil {
+		t.Fatalf("expected error for unknown version")
+	}
+}
+
+func TestUserRoundTrip(t *testing.T) {
+	// A fixed seed keeps failures reproducible.
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		u := randomUser(r)
+
+		b, err := EncodeUser(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodeUser(b)
+		if err != nil {
+			t.Fatalf("user %v: %v", i, err)
+		}
+
+		// Encoding the decoded user must be stable.  nil and empty
+		// slices encode differently, so the users themselves are only
+		// compared through their encoding.
+		again, err := EncodeUser(*decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, again) {
+			t.Fatalf("user %v: got %s, expected %s", i, again, b)
+		}
+	}
+}
+
+func TestVersionRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		v := Version{
+			Version: r.Uint32(),
+			Time:    r.Int63() - r.Int63(),
+		}
+
+		b, err := EncodeVersion(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodeVersion(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *decoded != v {
+			t.Fatalf("got %+v, expected %+v", *decoded, v)
+		}
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	// Every truncation of a valid record must fail to decode instead of
+	// silently returning a partial record.
+	vector := userVectors[UserVersion]
+	for i := 0; i < len(vector); i++ {
+		if _, err := DecodeUser([]byte(vector[:i])); err == nil {
+			t.Fatalf("truncated to %v bytes: expected error", i)
+		}
+	}
+
+	// Random bytes must never panic.
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		b := make([]byte, r.Intn(256))
+		r.Read(b)
+		DecodeUser(b)
+		DecodeVersion(b)
+	}
+
+	// Fields with the wrong type are rejected.
+	for _, payload := range []string{
+		`{"ID":"7"}`,
+		`{"Identities":[{"Key":[256]}]}`,
+		`{"HashedPassword":"not base64"}`,
+	} {
+		if _, err := DecodeUser([]byte(payload)); err == nil {
+			t.Fatalf("%v: expected error", payload)
+		}
+	}
+	if _, err := DecodeVersion([]byte(`{"version":-1}`)); err == nil {
+		t.Fatalf("expected error for negative version")
+	}
+}
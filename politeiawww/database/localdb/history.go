@@ -0,0 +1,202 @@
+package localdb
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/decred/politeia/politeiawww/database"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// userHistoryPrefix returns the key prefix of the history of a user.
+func userHistoryPrefix(email string) []byte {
+	return []byte(UserHistoryPrefix + email + ":")
+}
+
+// userHistoryKey returns the key of a previous version of a user record.
+// The version is zero padded so that versions are iterated in order.
+func userHistoryKey(email string, version uint64) []byte {
+	return []byte(fmt.Sprintf("%v%v:%016x", UserHistoryPrefix, email,
+		version))
+}
+
+// userHistory returns the retained versions of a user record, oldest first.
+//
+// This function must be called with the lock held.
+func (l *localdb) userHistory(email string) ([]database.UserHistoryEntry, error) {
+	var history []database.UserHistoryEntry
+	iter := l.userdb.NewIterator(util.BytesPrefix(userHistoryPrefix(email)),
+		nil)
+	for iter.Next() {
+		h, err := DecodeUserHistoryEntry(iter.Value())
+		if err != nil {
+			iter.Release()
+			return nil, err
+		}
+		history = append(history, *h)
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// redactUser returns a copy of the user record without the password hash,
+// the verification tokens and the two-factor secrets, which must not be
+// retained after they were replaced.
+func redactUser(u database.User) database.User {
+	u.HashedPassword = nil
+	u.NewUserVerificationToken = nil
+	u.UpdateKeyVerificationToken = nil
+	u.ResetPasswordVerificationToken = nil
+	u.EmailChangeVerificationToken = nil
+	if u.TOTP != nil {
+		totp := *u.TOTP
+		totp.Secret = nil
+		totp.RecoveryCodes = nil
+		u.TOTP = &totp
+	}
+	return u
+}
+
+// withoutBookkeeping returns a copy of the user record without the fields
+// that are updated by logins and paywall polling.
+func withoutBookkeeping(u database.User) database.User {
+	u.LastLoginTime = 0
+	u.FailedLoginAttempts = 0
+	u.LockedUntil = 0
+	u.LockReason = ""
+	u.NewUserPaywallPollExpiry = 0
+	u.ProposalPaywalls = append([]database.ProposalPaywall{},
+		u.ProposalPaywalls...)
+	for i := range u.ProposalPaywalls {
+		u.ProposalPaywalls[i].PollExpiry = 0
+	}
+	if u.TOTP != nil {
+		totp := *u.TOTP
+		totp.LastStep = 0
+		u.TOTP = &totp
+	}
+	return u
+}
+
+// bookkeepingOnly returns whether the user records only differ in the fields
+// that are updated by logins and paywall polling.  Such updates are not
+// retained in the history so that they can't push out the versions that
+// matter, e.g. by failing logins on purpose.
+func bookkeepingOnly(old, u database.User) (bool, error) {
+	a, err := EncodeUser(withoutBookkeeping(old))
+	if err != nil {
+		return false, err
+	}
+	b, err := EncodeUser(withoutBookkeeping(u))
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(a, b), nil
+}
+
+// appendUserHistory appends a version of the user record, without its
+// secrets, to the history and returns the versions that are retained, oldest
+// first.
+func appendUserHistory(history []database.UserHistoryEntry, u database.User) []database.UserHistoryEntry {
+	var version uint64
+	if len(history) > 0 {
+		version = history[len(history)-1].Version + 1
+	}
+
+	history = append(history, database.UserHistoryEntry{
+		Version:   version,
+		Timestamp: time.Now().Unix(),
+		User:      redactUser(u),
+	})
+	if len(history) > UserHistoryDepth {
+		history = history[len(history)-UserHistoryDepth:]
+	}
+
+	return history
+}
+
+// userHistoryBatch adds the current version of the user record to the user's
+// history, unless the update to u only changes bookkeeping, and removes the
+// versions that exceed UserHistoryDepth.
+//
+// This function must be called with the lock held.
+func (l *localdb) userHistoryBatch(batch *leveldb.Batch, updated database.User) error {
+	email := updated.Email
+	payload, err := l.userdb.Get([]byte(email), nil)
+	if err == leveldb.ErrNotFound {
+		return database.ErrUserNotFound
+	} else if err != nil {
+		return err
+	}
+
+	u, err := DecodeUser(payload)
+	if err != nil {
+		return err
+	}
+	skip, err := bookkeepingOnly(*u, updated)
+	if err != nil || skip {
+		return err
+	}
+
+	history, err := l.userHistory(email)
+	if err != nil {
+		return err
+	}
+	retained := appendUserHistory(append([]database.UserHistoryEntry{},
+		history...), *u)
+
+	// Remove the versions that were pruned and add the new one.
+	for _, h := range history {
+		if h.Version < retained[0].Version {
+			batch.Delete(userHistoryKey(email, h.Version))
+		}
+	}
+	added := retained[len(retained)-1]
+	b, err := EncodeUserHistoryEntry(added)
+	if err != nil {
+		return err
+	}
+	batch.Put(userHistoryKey(email, added.Version), b)
+
+	return nil
+}
+
+// UserHistory returns the retained previous versions of a user record, most
+// recent first.
+//
+// UserHistory satisfies the backend interface.
+func (l *localdb) UserHistory(email string) ([]database.UserHistoryEntry, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return nil, database.ErrShutdown
+	}
+
+	log.Debugf("UserHistory: %v", email)
+
+	exists, err := l.userdb.Has([]byte(email), nil)
+	if err != nil {
+		return nil, wrapErr("UserHistory", email, err)
+	} else if !exists {
+		return nil, database.ErrUserNotFound
+	}
+
+	history, err := l.userHistory(email)
+	if err != nil {
+		return nil, wrapErr("UserHistory", email, err)
+	}
+
+	// Reverse so that the most recent version comes first.
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+
+	return history, nil
+}
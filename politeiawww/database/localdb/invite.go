@@ -0,0 +1,139 @@
+package localdb
+
+import (
+	"encoding/hex"
+	"time"
+
+	"github.com/decred/politeia/politeiawww/database"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// inviteKey returns the key of the invitation with the given token hash.
+func inviteKey(tokenHash []byte) string {
+	return InvitePrefix + hex.EncodeToString(tokenHash)
+}
+
+// getInvite returns the invitation with the given token if it can be
+// redeemed.
+//
+// This function must be called with the lock held.
+func (l *localdb) getInvite(op string, token []byte) (string, *database.Invitation, error) {
+	key := inviteKey(database.HashInviteToken(token))
+	payload, err := l.userdb.Get([]byte(key), nil)
+	if err == leveldb.ErrNotFound {
+		return "", nil, database.ErrInviteNotFound
+	} else if err != nil {
+		return "", nil, wrapErr(op, key, err)
+	}
+
+	i, err := DecodeInvitation(payload)
+	if err != nil {
+		return "", nil, wrapErr(op, key, err)
+	}
+
+	if err = database.CheckInvitation(i, time.Now()); err != nil {
+		return "", nil, err
+	}
+
+	return key, i, nil
+}
+
+// InviteNew stores a new invitation.
+//
+// InviteNew satisfies the backend interface.
+func (l *localdb) InviteNew(i database.Invitation) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return database.ErrShutdown
+	}
+
+	key := inviteKey(i.TokenHash)
+	log.Debugf("InviteNew: %v", database.HashKey(key))
+
+	payload, err := EncodeInvitation(i)
+	if err != nil {
+		return wrapErr("InviteNew", key, err)
+	}
+
+	return wrapErr("InviteNew", key, l.userdb.Put([]byte(key), payload,
+		nil))
+}
+
+// InviteGet returns the invitation with the given token.  It returns
+// ErrInviteExpired or ErrInviteRedeemed if the invitation can't be redeemed.
+//
+// InviteGet satisfies the backend interface.
+func (l *localdb) InviteGet(token []byte) (*database.Invitation, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return nil, database.ErrShutdown
+	}
+
+	log.Debugf("InviteGet")
+
+	_, i, err := l.getInvite("InviteGet", token)
+	return i, err
+}
+
+// InviteRedeem marks the invitation with the given token as used by the
+// user.  An invitation can only be redeemed once.
+//
+// InviteRedeem satisfies the backend interface.
+func (l *localdb) InviteRedeem(token []byte, userID uint64) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return database.ErrShutdown
+	}
+
+	log.Debugf("InviteRedeem: %v", userID)
+
+	key, i, err := l.getInvite("InviteRedeem", token)
+	if err != nil {
+		return err
+	}
+
+	i.RedeemedBy = userID
+	i.RedeemedAt = time.Now().Unix()
+	payload, err := EncodeInvitation(*i)
+	if err != nil {
+		return wrapErr("InviteRedeem", key, err)
+	}
+
+	return wrapErr("InviteRedeem", key, l.userdb.Put([]byte(key), payload,
+		nil))
+}
+
+// AllInvites iterates all invitations, including expired and redeemed ones.
+//
+// AllInvites satisfies the backend interface.
+func (l *localdb) AllInvites(callbackFn func(i *database.Invitation)) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return database.ErrShutdown
+	}
+
+	log.Debugf("AllInvites")
+
+	iter := l.userdb.NewIterator(util.BytesPrefix([]byte(InvitePrefix)), nil)
+	for iter.Next() {
+		i, err := DecodeInvitation(iter.Value())
+		if err != nil {
+			iter.Release()
+			return wrapErr("AllInvites", "", err)
+		}
+
+		callbackFn(i)
+	}
+	iter.Release()
+
+	return wrapErr("AllInvites", "", iter.Error())
+}
@@ -1,26 +1,99 @@
 package localdb
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/badoux/checkmail"
 	"github.com/decred/politeia/politeiawww/database"
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 const (
 	UserdbPath    = "users"
 	LastUserIdKey = "lastuserid"
 
-	UserVersion    uint32 = 1
+	UserVersion    uint32 = 2
 	UserVersionKey        = "userversion"
+
+	// ChecksumVersion is the first database version that stores a
+	// checksum for every user record.
+	ChecksumVersion uint32 = 2
+
+	// UserChecksumPrefix is prepended to the user email to create the key
+	// that holds the SHA256 checksum of the user record payload.
+	UserChecksumPrefix = "checksum:"
+
+	// CounterPrefix is prepended to the key of counters that are created
+	// through Increment and of the counters that email queue and audit log
+	// ids are allocated from.
+	CounterPrefix = "counter:"
+
+	// OperationPrefix is prepended to a client supplied operation ID to
+	// create the key that records when the operation was applied.
+	OperationPrefix = "op:"
+
+	// SessionPrefix is prepended to the session ID to create the key
+	// under which a session is stored.
+	SessionPrefix = "session:"
+
+	// EmailQueuePrefix is prepended to the hex encoded email ID to create
+	// the key under which a queued email is stored.
+	EmailQueuePrefix = "emailqueue:"
+
+	// LastEmailIdKey is the counter used to allocate queued email IDs.
+	LastEmailIdKey = CounterPrefix + "lastemailid"
+
+	// AuditPrefix is prepended to the hex encoded audit entry ID to create
+	// the key under which an audit log entry is stored.
+	AuditPrefix = "audit:"
+
+	// LastAuditIdKey is the counter used to allocate audit entry IDs.
+	LastAuditIdKey = CounterPrefix + "lastauditid"
+
+	// UserHistoryPrefix is prepended to "<email>:<version>" to create the
+	// key under which a previous version of a user record is stored.
+	UserHistoryPrefix = "user_history:"
+
+	// PreferencesPrefix is prepended to the user ID to create the key
+	// under which the preferences of a user are stored.
+	PreferencesPrefix = "prefs:"
+
+	// InvitePrefix is prepended to the hex encoded hash of the invite
+	// token to create the key under which an invitation is stored.
+	InvitePrefix = "invite:"
+
+	// UserHistoryDepth is the number of previous versions that are kept
+	// for every user.
+	UserHistoryDepth = 5
+
+	// OperationExpiry is the amount of time an operation ID is retained
+	// after the operation has been applied.
+	OperationExpiry = 24 * time.Hour
 )
 
 var (
 	_ database.Database = (*localdb)(nil)
+
+	// recordPrefixes contains the key prefixes of all records that are not
+	// user records.
+	recordPrefixes = []string{
+		UserChecksumPrefix,
+		CounterPrefix,
+		OperationPrefix,
+		SessionPrefix,
+		EmailQueuePrefix,
+		AuditPrefix,
+		UserHistoryPrefix,
+		PreferencesPrefix,
+		InvitePrefix,
+	}
 )
 
 // localdb implements the database interface.
@@ -37,11 +110,175 @@ type Version struct {
 	Time    int64  `json:"time"`    // Time of record creation
 }
 
-// isUserRecord returns true if the given key is a user record,
+// backendName is recorded in the errors of the underlying leveldb database.
+const backendName = "leveldb"
+
+// wrapErr wraps an error of the underlying leveldb database, see
+// database.WrapError.
+func wrapErr(op, key string, err error) error {
+	return database.WrapError(backendName, op, key, err)
+}
+
+// IsUserRecord returns true if the given key is a user record,
 // and false otherwise. This is helpful when iterating the user records
 // because the DB contains some non-user records.
-func isUserRecord(key string) bool {
-	return key != UserVersionKey && key != LastUserIdKey
+func IsUserRecord(key string) bool {
+	if key == UserVersionKey || key == LastUserIdKey {
+		return false
+	}
+	for _, prefix := range recordPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// increment increments the counter stored under key and returns its new
+// value.  A counter that does not exist yet is created with a value of zero.
+//
+// This function must be called with the lock held.
+func (l *localdb) increment(key []byte) (uint64, error) {
+	var counter uint64
+	b, err := l.userdb.Get(key, nil)
+	if err != nil {
+		if err != leveldb.ErrNotFound {
+			return 0, err
+		}
+	} else if len(b) != 8 {
+		return 0, database.ErrUnknownRecord
+	} else {
+		counter = binary.LittleEndian.Uint64(b) + 1
+	}
+
+	b = make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, counter)
+	err = l.userdb.Put(key, b, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return counter, nil
+}
+
+// encodeTimestamp encodes a unix timestamp into a byte slice.
+func encodeTimestamp(t int64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(t))
+	return b
+}
+
+// decodeTimestamp decodes a byte slice produced by encodeTimestamp.
+func decodeTimestamp(b []byte) (int64, bool) {
+	if len(b) != 8 {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(b)), true
+}
+
+// userBatch returns a batch that writes the encoded user record along with
+// the SHA256 checksum of the encoded payload.
+func userBatch(u database.User) (*leveldb.Batch, error) {
+	payload, err := EncodeUser(u)
+	if err != nil {
+		return nil, err
+	}
+	checksum := sha256.Sum256(payload)
+
+	batch := new(leveldb.Batch)
+	batch.Put([]byte(u.Email), payload)
+	batch.Put([]byte(UserChecksumPrefix+u.Email), checksum[:])
+	return batch, nil
+}
+
+// putUser encodes the user record and writes it, along with the SHA256
+// checksum of the encoded payload, to the database in a single batch.
+//
+// This function must be called with the lock held.
+func (l *localdb) putUser(u database.User) error {
+	batch, err := userBatch(u)
+	if err != nil {
+		return err
+	}
+	return l.userdb.Write(batch, nil)
+}
+
+// operationApplied returns whether an unexpired operation with the given ID
+// has been recorded.
+//
+// This function must be called with the lock held.
+func (l *localdb) operationApplied(opID string) (bool, error) {
+	b, err := l.userdb.Get([]byte(OperationPrefix+opID), nil)
+	if err == leveldb.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	applied, ok := decodeTimestamp(b)
+	if !ok {
+		return false, database.ErrUnknownRecord
+	}
+
+	return time.Since(time.Unix(applied, 0)) < OperationExpiry, nil
+}
+
+// pruneOperations removes all expired operation records.
+//
+// This function must be called with the lock held.
+func (l *localdb) pruneOperations() error {
+	batch := new(leveldb.Batch)
+	iter := l.userdb.NewIterator(util.BytesPrefix([]byte(OperationPrefix)), nil)
+	for iter.Next() {
+		applied, ok := decodeTimestamp(iter.Value())
+		if ok && time.Since(time.Unix(applied, 0)) < OperationExpiry {
+			continue
+		}
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	if batch.Len() == 0 {
+		return nil
+	}
+
+	log.Debugf("pruneOperations: %v expired operations", batch.Len())
+
+	return l.userdb.Write(batch, nil)
+}
+
+// verifyUserRecord decodes the user record payload and compares its checksum
+// against the one stored in the database.  A missing checksum is only an
+// error if checksums are required by the database version.
+func verifyUserRecord(userdb *leveldb.DB, key string, payload []byte, checksums bool) error {
+	if err := checkmail.ValidateFormat(key); err != nil {
+		return database.ErrUnknownRecord
+	}
+
+	_, err := DecodeUser(payload)
+	if err != nil {
+		return err
+	}
+
+	checksum, err := userdb.Get([]byte(UserChecksumPrefix+key), nil)
+	if err == leveldb.ErrNotFound {
+		if !checksums {
+			return nil
+		}
+		return database.ErrChecksumMissing
+	} else if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(payload)
+	if !bytes.Equal(checksum, sum[:]) {
+		return database.ErrChecksumMismatch
+	}
+
+	return nil
 }
 
 // Store new user.
@@ -55,7 +292,7 @@ func (l *localdb) UserNew(u database.User) error {
 		return database.ErrShutdown
 	}
 
-	log.Debugf("UserNew: %v", u)
+	log.Debugf("UserNew: %v", u.Email)
 
 	if err := checkmail.ValidateFormat(u.Email); err != nil {
 		return database.ErrInvalidEmail
@@ -64,39 +301,18 @@ func (l *localdb) UserNew(u database.User) error {
 	// Make sure user does not exist
 	ok, err := l.userdb.Has([]byte(u.Email), nil)
 	if err != nil {
-		return err
+		return wrapErr("UserNew", u.Email, err)
 	} else if ok {
 		return database.ErrUserExists
 	}
 
 	// Fetch the next unique ID for the user.
-	var lastUserId uint64
-	b, err := l.userdb.Get([]byte(LastUserIdKey), nil)
-	if err != nil {
-		if err != leveldb.ErrNotFound {
-			return err
-		}
-	} else {
-		lastUserId = binary.LittleEndian.Uint64(b) + 1
-	}
-
-	// Set the new id on the user.
-	u.ID = lastUserId
-
-	// Write the new id back to the db.
-	b = make([]byte, 8)
-	binary.LittleEndian.PutUint64(b, lastUserId)
-	err = l.userdb.Put([]byte(LastUserIdKey), b, nil)
-	if err != nil {
-		return err
-	}
-
-	payload, err := EncodeUser(u)
+	u.ID, err = l.increment([]byte(LastUserIdKey))
 	if err != nil {
-		return err
+		return wrapErr("UserNew", u.Email, err)
 	}
 
-	return l.userdb.Put([]byte(u.Email), payload, nil)
+	return wrapErr("UserNew", u.Email, l.putUser(u))
 }
 
 // UserGet returns a user record if found in the database.
@@ -114,12 +330,12 @@ func (l *localdb) UserGet(email string) (*database.User, error) {
 	if err == leveldb.ErrNotFound {
 		return nil, database.ErrUserNotFound
 	} else if err != nil {
-		return nil, err
+		return nil, wrapErr("UserGet", email, err)
 	}
 
 	u, err := DecodeUser(payload)
 	if err != nil {
-		return nil, err
+		return nil, wrapErr("UserGet", email, err)
 	}
 
 	return u, nil
@@ -136,20 +352,20 @@ func (l *localdb) UserGetByUsername(username string) (*database.User, error) {
 		return nil, database.ErrShutdown
 	}
 
-	log.Debugf("UserGetByUsername\n")
+	log.Debugf("UserGetByUsername")
 
 	iter := l.userdb.NewIterator(nil, nil)
 	for iter.Next() {
 		key := iter.Key()
 		value := iter.Value()
 
-		if !isUserRecord(string(key)) {
+		if !IsUserRecord(string(key)) {
 			continue
 		}
 
 		user, err := DecodeUser(value)
 		if err != nil {
-			return nil, err
+			return nil, wrapErr("UserGetByUsername", username, err)
 		}
 
 		if strings.ToLower(user.Username) == strings.ToLower(username) {
@@ -158,7 +374,7 @@ func (l *localdb) UserGetByUsername(username string) (*database.User, error) {
 	}
 	iter.Release()
 
-	return nil, iter.Error()
+	return nil, wrapErr("UserGetByUsername", username, iter.Error())
 }
 
 // UserGetById returns a user record given its id, if found in the database.
@@ -172,20 +388,20 @@ func (l *localdb) UserGetById(id uint64) (*database.User, error) {
 		return nil, database.ErrShutdown
 	}
 
-	log.Debugf("UserGetById\n")
+	log.Debugf("UserGetById")
 
 	iter := l.userdb.NewIterator(nil, nil)
 	for iter.Next() {
 		key := iter.Key()
 		value := iter.Value()
 
-		if !isUserRecord(string(key)) {
+		if !IsUserRecord(string(key)) {
 			continue
 		}
 
 		user, err := DecodeUser(value)
 		if err != nil {
-			return nil, err
+			return nil, wrapErr("UserGetById", "", err)
 		}
 
 		if user.ID == id {
@@ -194,7 +410,52 @@ func (l *localdb) UserGetById(id uint64) (*database.User, error) {
 	}
 	iter.Release()
 
-	return nil, iter.Error()
+	return nil, wrapErr("UserGetById", "", iter.Error())
+}
+
+// Increment atomically increments the counter stored under the given key.
+// Counters are kept in their own key space so they never collide with user
+// records.  Paywall indexes used to be derived from user IDs, so a new
+// counter starts after the last allocated user ID.
+//
+// Increment satisfies the backend interface.
+func (l *localdb) Increment(key string) (uint64, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return 0, database.ErrShutdown
+	}
+
+	log.Debugf("Increment: %v", key)
+
+	counterKey := []byte(CounterPrefix + key)
+	_, err := l.userdb.Get(counterKey, nil)
+	if err == leveldb.ErrNotFound {
+		err = l.seedCounter(counterKey)
+	}
+	if err != nil {
+		return 0, wrapErr("Increment", key, err)
+	}
+
+	v, err := l.increment(counterKey)
+	return v, wrapErr("Increment", key, err)
+}
+
+// seedCounter creates the counter stored under key with the last allocated
+// user ID, so that its first increment returns the next unused user ID.  A
+// database without users leaves the counter unset, so it starts at zero.
+func (l *localdb) seedCounter(key []byte) error {
+	b, err := l.userdb.Get([]byte(LastUserIdKey), nil)
+	if err == leveldb.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if len(b) != 8 {
+		return database.ErrUnknownRecord
+	}
+	return l.userdb.Put(key, b, nil)
 }
 
 // Update existing user.
@@ -208,22 +469,127 @@ func (l *localdb) UserUpdate(u database.User) error {
 		return database.ErrShutdown
 	}
 
-	log.Debugf("UserUpdate: %v", u)
+	log.Debugf("UserUpdate: %v", u.Email)
 
-	// Make sure user already exists
-	exists, err := l.userdb.Has([]byte(u.Email), nil)
+	batch, err := userBatch(u)
 	if err != nil {
-		return err
-	} else if !exists {
+		return wrapErr("UserUpdate", u.Email, err)
+	}
+
+	// Retain the current version of the user record if the update is
+	// not only bookkeeping.  This fails with ErrUserNotFound if the user
+	// does not exist.
+	err = l.userHistoryBatch(batch, u)
+	if err != nil {
+		return wrapErr("UserUpdate", u.Email, err)
+	}
+
+	return wrapErr("UserUpdate", u.Email, l.userdb.Write(batch, nil))
+}
+
+// UserUpdateOnce updates an existing user and records the operation ID in the
+// same batch.  If the operation ID has already been recorded the update is
+// skipped and ErrDuplicateOperation is returned.
+//
+// UserUpdateOnce satisfies the backend interface.
+func (l *localdb) UserUpdateOnce(opID string, u database.User) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return database.ErrShutdown
+	}
+
+	log.Debugf("UserUpdateOnce: %v %v", opID, u.Email)
+
+	applied, err := l.operationApplied(opID)
+	if err != nil {
+		return wrapErr("UserUpdateOnce", u.Email, err)
+	} else if applied {
+		return database.ErrDuplicateOperation
+	}
+
+	batch, err := userBatch(u)
+	if err != nil {
+		return wrapErr("UserUpdateOnce", u.Email, err)
+	}
+
+	// Retain the current version of the user record if the update is
+	// not only bookkeeping.  This fails with ErrUserNotFound if the user
+	// does not exist.
+	err = l.userHistoryBatch(batch, u)
+	if err != nil {
+		return wrapErr("UserUpdateOnce", u.Email, err)
+	}
+	batch.Put([]byte(OperationPrefix+opID),
+		encodeTimestamp(time.Now().Unix()))
+
+	return wrapErr("UserUpdateOnce", u.Email, l.userdb.Write(batch, nil))
+}
+
+// UserChangeEmail rewrites the user record under the new email.  The record,
+// its checksum and its history are moved in a single batch.
+//
+// UserChangeEmail satisfies the backend interface.
+func (l *localdb) UserChangeEmail(oldEmail, newEmail string) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return database.ErrShutdown
+	}
+
+	log.Debugf("UserChangeEmail: %v %v", oldEmail, newEmail)
+
+	if err := checkmail.ValidateFormat(newEmail); err != nil {
+		return database.ErrInvalidEmail
+	}
+
+	// Make sure the new email is not in use
+	exists, err := l.userdb.Has([]byte(newEmail), nil)
+	if err != nil {
+		return wrapErr("UserChangeEmail", oldEmail, err)
+	} else if exists {
+		return database.ErrUserExists
+	}
+
+	payload, err := l.userdb.Get([]byte(oldEmail), nil)
+	if err == leveldb.ErrNotFound {
 		return database.ErrUserNotFound
+	} else if err != nil {
+		return wrapErr("UserChangeEmail", oldEmail, err)
+	}
+	u, err := DecodeUser(payload)
+	if err != nil {
+		return wrapErr("UserChangeEmail", oldEmail, err)
 	}
 
-	payload, err := EncodeUser(u)
+	// Move the history to the new email, including the current version.
+	history, err := l.userHistory(oldEmail)
 	if err != nil {
-		return err
+		return wrapErr("UserChangeEmail", oldEmail, err)
+	}
+	retained := appendUserHistory(history, *u)
+
+	u.Email = newEmail
+	batch, err := userBatch(*u)
+	if err != nil {
+		return wrapErr("UserChangeEmail", oldEmail, err)
+	}
+	batch.Delete([]byte(oldEmail))
+	batch.Delete([]byte(UserChecksumPrefix + oldEmail))
+	for _, h := range history {
+		batch.Delete(userHistoryKey(oldEmail, h.Version))
+	}
+	for _, h := range retained {
+		b, err := EncodeUserHistoryEntry(h)
+		if err != nil {
+			return wrapErr("UserChangeEmail", oldEmail, err)
+		}
+		batch.Put(userHistoryKey(newEmail, h.Version), b)
 	}
 
-	return l.userdb.Put([]byte(u.Email), payload, nil)
+	return wrapErr("UserChangeEmail", oldEmail, l.userdb.Write(batch, nil))
 }
 
 // Update existing user.
@@ -237,26 +603,126 @@ func (l *localdb) AllUsers(callbackFn func(u *database.User)) error {
 		return database.ErrShutdown
 	}
 
-	log.Debugf("AllUsers\n")
+	log.Debugf("AllUsers")
 
 	iter := l.userdb.NewIterator(nil, nil)
 	for iter.Next() {
 		key := iter.Key()
 		value := iter.Value()
 
-		if !isUserRecord(string(key)) {
+		if !IsUserRecord(string(key)) {
 			continue
 		}
 
 		u, err := DecodeUser(value)
 		if err != nil {
-			return err
+			return wrapErr("AllUsers", "", err)
 		}
 
 		callbackFn(u)
 	}
 	iter.Release()
 
+	return wrapErr("AllUsers", "", iter.Error())
+}
+
+// VerifyIntegrity iterates every record in the database and reports the
+// result of verifying each one to the callback.
+//
+// VerifyIntegrity satisfies the backend interface.
+func (l *localdb) VerifyIntegrity(callbackFn func(key string, err error)) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return database.ErrShutdown
+	}
+
+	log.Debugf("VerifyIntegrity")
+
+	return wrapErr("VerifyIntegrity", "", VerifyRecords(l.userdb,
+		callbackFn))
+}
+
+// VerifyRecords iterates every record of an open user database and reports
+// the result of verifying each one to the callback.  It allows tools to
+// verify a database without opening it through the backend, which writes a
+// version record if there is none.
+func VerifyRecords(userdb *leveldb.DB, callbackFn func(key string, err error)) error {
+	return VerifyRecordsRange(userdb, nil, callbackFn)
+}
+
+// VerifyRecordsRange is VerifyRecords limited to the records in the given
+// key range.  A nil range verifies every record.  It allows tools to resume
+// an interrupted verification.
+func VerifyRecordsRange(userdb *leveldb.DB, slice *util.Range, callbackFn func(key string, err error)) error {
+	// User records of databases that predate checksums don't have one
+	// until the database is upgraded.
+	checksums := true
+	b, err := userdb.Get([]byte(UserVersionKey), nil)
+	if err == nil {
+		v, err := DecodeVersion(b)
+		if err == nil && v.Version < ChecksumVersion {
+			checksums = false
+		}
+	} else if err != leveldb.ErrNotFound {
+		return err
+	}
+
+	iter := userdb.NewIterator(slice, nil)
+	for iter.Next() {
+		key := string(iter.Key())
+		value := iter.Value()
+
+		var err error
+		switch {
+		case IsUserRecord(key):
+			err = verifyUserRecord(userdb, key, value, checksums)
+		case key == UserVersionKey:
+			_, err = DecodeVersion(value)
+		case key == LastUserIdKey, strings.HasPrefix(key, CounterPrefix):
+			if len(value) != 8 {
+				err = database.ErrUnknownRecord
+			}
+		case strings.HasPrefix(key, OperationPrefix):
+			if _, ok := decodeTimestamp(value); !ok {
+				err = database.ErrUnknownRecord
+			}
+		case strings.HasPrefix(key, SessionPrefix):
+			_, err = DecodeSession(value)
+		case strings.HasPrefix(key, EmailQueuePrefix):
+			_, err = DecodeQueuedEmail(value)
+		case strings.HasPrefix(key, UserHistoryPrefix):
+			_, err = DecodeUserHistoryEntry(value)
+		case strings.HasPrefix(key, AuditPrefix):
+			_, err = DecodeAuditEntry(value)
+		case strings.HasPrefix(key, PreferencesPrefix):
+			var p *database.UserPreferences
+			p, err = DecodeUserPreferences(value)
+			if err == nil && key != preferencesKey(p.UserID) {
+				err = database.ErrUnknownRecord
+			}
+		case strings.HasPrefix(key, InvitePrefix):
+			var i *database.Invitation
+			i, err = DecodeInvitation(value)
+			if err == nil && key != inviteKey(i.TokenHash) {
+				err = database.ErrUnknownRecord
+			}
+		case strings.HasPrefix(key, UserChecksumPrefix):
+			var exists bool
+			exists, err = userdb.Has([]byte(strings.TrimPrefix(key,
+				UserChecksumPrefix)), nil)
+			if err == nil && !exists {
+				err = database.ErrUserNotFound
+			}
+		default:
+			err = database.ErrUnknownRecord
+		}
+
+		callbackFn(key, err)
+	}
+	iter.Release()
+
 	return iter.Error()
 }
 
@@ -269,7 +735,7 @@ func (l *localdb) Close() error {
 	defer l.Unlock()
 
 	l.shutdown = true
-	return l.userdb.Close()
+	return wrapErr("Close", "", l.userdb.Close())
 }
 
 // New creates a new localdb instance.
@@ -284,5 +750,14 @@ func New(root string) (*localdb, error) {
 		return nil, err
 	}
 
+	err = l.pruneOperations()
+	if err == nil {
+		err = l.pruneSessions()
+	}
+	if err != nil {
+		l.userdb.Close()
+		return nil, err
+	}
+
 	return l, nil
 }
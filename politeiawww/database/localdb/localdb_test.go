@@ -0,0 +1,786 @@
+package localdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/decred/politeia/politeiawww/database"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+func newTestLocaldb(t *testing.T) (*localdb, func()) {
+	dir, err := ioutil.TempDir("", "localdb.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := New(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return l, func() {
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestVerifyIntegrity(t *testing.T) {
+	l, cleanup := newTestLocaldb(t)
+	defer cleanup()
+
+	u := database.User{
+		Email:    "user@example.com",
+		Username: "user",
+	}
+	if err := l.UserNew(u); err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func() map[string]error {
+		results := make(map[string]error)
+		err := l.VerifyIntegrity(func(key string, err error) {
+			results[key] = err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	for key, err := range verify() {
+		if err != nil {
+			t.Fatalf("unexpected error for %v: %v", key, err)
+		}
+	}
+
+	// Tamper with the user record payload.
+	payload, err := EncodeUser(database.User{
+		Email:    u.Email,
+		Username: "tampered",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l.userdb.Put([]byte(u.Email), payload, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify()[u.Email]; err != database.ErrChecksumMismatch {
+		t.Fatalf("expected %v, got %v", database.ErrChecksumMismatch, err)
+	}
+
+	// Remove the checksum.
+	err = l.userdb.Delete([]byte(UserChecksumPrefix+u.Email), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify()[u.Email]; err != database.ErrChecksumMissing {
+		t.Fatalf("expected %v, got %v", database.ErrChecksumMissing, err)
+	}
+
+	// Add a record that is neither a user nor a known record type.
+	err = l.userdb.Put([]byte("garbage"), []byte("{}"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify()["garbage"]; err != database.ErrUnknownRecord {
+		t.Fatalf("expected %v, got %v", database.ErrUnknownRecord, err)
+	}
+}
+
+// TestUpgradeBaseline verifies that a database written before record
+// checksums were introduced verifies as is and is upgraded when opened.
+func TestUpgradeBaseline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localdb.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Write the records as the first database version did.
+	const email = "user@example.com"
+	userdb, err := leveldb.OpenFile(filepath.Join(dir, UserdbPath), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastUserID := make([]byte, 8)
+	binary.LittleEndian.PutUint64(lastUserID, 7)
+	batch := new(leveldb.Batch)
+	batch.Put([]byte(UserVersionKey), []byte(`{"version":1,"time":1530000000}`))
+	batch.Put([]byte(LastUserIdKey), lastUserID)
+	batch.Put([]byte(email), []byte(userVectorV1))
+	if err = userdb.Write(batch, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func(userdb *leveldb.DB) {
+		t.Helper()
+		err := VerifyRecords(userdb, func(key string, err error) {
+			if err != nil {
+				t.Fatalf("unexpected error for %v: %v", key, err)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	verify(userdb)
+
+	// A range only verifies the records after its start.
+	var keys []string
+	err = VerifyRecordsRange(userdb, &util.Range{Start: []byte(email + "\x00")},
+		func(key string, err error) {
+			keys = append(keys, key)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != UserVersionKey {
+		t.Fatalf("got %v, expected %v", keys, UserVersionKey)
+	}
+	userdb.Close()
+
+	l, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	verify(l.userdb)
+
+	b, err := l.userdb.Get([]byte(UserVersionKey), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := DecodeVersion(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != UserVersion {
+		t.Fatalf("got version %v, expected %v", v.Version, UserVersion)
+	}
+	if _, err = l.userdb.Get([]byte(UserChecksumPrefix+email), nil); err != nil {
+		t.Fatalf("checksum not added: %v", err)
+	}
+	if _, err = l.UserGet(email); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWrongVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localdb.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	userdb, err := leveldb.OpenFile(filepath.Join(dir, UserdbPath), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = SetVersion(userdb, UserVersion+1); err != nil {
+		t.Fatal(err)
+	}
+	userdb.Close()
+
+	if _, err = New(dir); err != database.ErrWrongVersion {
+		t.Fatalf("expected %v, got %v", database.ErrWrongVersion, err)
+	}
+
+	// The database must have been closed so that it can be repaired.
+	userdb, err = leveldb.OpenFile(filepath.Join(dir, UserdbPath), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userdb.Close()
+}
+
+func TestUserUpdateOnce(t *testing.T) {
+	l, cleanup := newTestLocaldb(t)
+	defer cleanup()
+
+	u := database.User{
+		Email:    "user@example.com",
+		Username: "user",
+	}
+	if err := l.UserNew(u); err != nil {
+		t.Fatal(err)
+	}
+
+	u.Admin = true
+	if err := l.UserUpdateOnce("op1", u); err != nil {
+		t.Fatal(err)
+	}
+
+	u.Admin = false
+	err := l.UserUpdateOnce("op1", u)
+	if err != database.ErrDuplicateOperation {
+		t.Fatalf("expected %v, got %v", database.ErrDuplicateOperation, err)
+	}
+
+	stored, err := l.UserGet(u.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.Admin {
+		t.Fatalf("duplicate operation was applied")
+	}
+
+	// Expired operations are pruned and may be applied again.
+	expired := time.Now().Add(-2 * OperationExpiry).Unix()
+	err = l.userdb.Put([]byte(OperationPrefix+"op1"),
+		encodeTimestamp(expired), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.pruneOperations(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.UserUpdateOnce("op1", u); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	l, cleanup := newTestLocaldb(t)
+	defer cleanup()
+
+	for i := uint64(0); i < 3; i++ {
+		v, err := l.Increment("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != i {
+			t.Fatalf("expected %v, got %v", i, v)
+		}
+	}
+
+	// User IDs are allocated from their own counter.
+	for i := 0; i < 2; i++ {
+		u := database.User{
+			Email:    fmt.Sprintf("user%v@example.com", i),
+			Username: fmt.Sprintf("user%v", i),
+		}
+		if err := l.UserNew(u); err != nil {
+			t.Fatal(err)
+		}
+		stored, err := l.UserGet(u.Email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.ID != uint64(i) {
+			t.Fatalf("expected user id %v, got %v", i, stored.ID)
+		}
+	}
+
+	// A new counter starts after the last allocated user ID.
+	v, err := l.Increment("paywall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 2 {
+		t.Fatalf("expected 2, got %v", v)
+	}
+}
+
+func TestEmailQueue(t *testing.T) {
+	l, cleanup := newTestLocaldb(t)
+	defer cleanup()
+
+	id, err := l.EmailEnqueue(database.QueuedEmail{
+		To:      []string{"user@example.com"},
+		Subject: "subject",
+		Body:    "body",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := l.EmailClaim()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != id {
+		t.Fatalf("expected email %v, got %v", id, e.ID)
+	}
+
+	// A claimed email can't be claimed again until the claim expires.
+	_, err = l.EmailClaim()
+	if err != database.ErrEmailQueueEmpty {
+		t.Fatalf("expected %v, got %v", database.ErrEmailQueueEmpty, err)
+	}
+
+	// A retried email is not due until its backoff has passed.
+	if err := l.EmailRetry(id, errors.New("send failed")); err != nil {
+		t.Fatal(err)
+	}
+	_, err = l.EmailClaim()
+	if err != database.ErrEmailQueueEmpty {
+		t.Fatalf("expected %v, got %v", database.ErrEmailQueueEmpty, err)
+	}
+
+	var queued []*database.QueuedEmail
+	err = l.AllQueuedEmails(func(e *database.QueuedEmail) {
+		queued = append(queued, e)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 1 || queued[0].Attempts != 1 ||
+		queued[0].LastError != "send failed" {
+		t.Fatalf("unexpected queue %v", queued)
+	}
+
+	if err := l.EmailMarkSent(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.EmailDelete(id); err != database.ErrEmailNotFound {
+		t.Fatalf("expected %v, got %v", database.ErrEmailNotFound, err)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	l, cleanup := newTestLocaldb(t)
+	defer cleanup()
+
+	for i := int64(1); i <= 3; i++ {
+		err := l.AuditLogAppend(database.AuditEntry{
+			Actor:     "admin",
+			Action:    "setadmin",
+			Target:    "user@example.com",
+			Timestamp: i * 100,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var entries []*database.AuditEntry
+	err := l.AuditLog(200, 300, func(a *database.AuditEntry) {
+		entries = append(entries, a)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Timestamp != 200 ||
+		entries[0].ID != 1 {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+
+	entries = nil
+	err = l.AuditLog(0, 0, func(a *database.AuditEntry) {
+		entries = append(entries, a)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %v", len(entries))
+	}
+}
+
+func TestUserHistory(t *testing.T) {
+	l, cleanup := newTestLocaldb(t)
+	defer cleanup()
+
+	u := database.User{
+		Email:    "user@example.com",
+		Username: "user0",
+	}
+	if err := l.UserNew(u); err != nil {
+		t.Fatal(err)
+	}
+
+	updates := UserHistoryDepth + 2
+	for i := 1; i <= updates; i++ {
+		u.Username = fmt.Sprintf("user%v", i)
+		if err := l.UserUpdate(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := l.UserHistory(u.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != UserHistoryDepth {
+		t.Fatalf("expected %v versions, got %v", UserHistoryDepth,
+			len(history))
+	}
+	for i, h := range history {
+		expected := fmt.Sprintf("user%v", updates-1-i)
+		if h.User.Username != expected {
+			t.Fatalf("version %v: expected %v, got %v", i, expected,
+				h.User.Username)
+		}
+	}
+
+	// Login bookkeeping doesn't push out previous versions.
+	for i := 0; i < UserHistoryDepth; i++ {
+		u.FailedLoginAttempts++
+		u.LastLoginTime = int64(i)
+		if err := l.UserUpdate(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bookkeeping, err := l.UserHistory(u.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(bookkeeping, history) {
+		t.Fatalf("bookkeeping updates changed the history")
+	}
+
+	// Secrets are not retained.
+	u.HashedPassword = []byte("hash")
+	u.ResetPasswordVerificationToken = []byte("token")
+	if err := l.UserUpdate(u); err != nil {
+		t.Fatal(err)
+	}
+	u.HashedPassword = []byte("newhash")
+	u.ResetPasswordVerificationToken = nil
+	if err := l.UserUpdate(u); err != nil {
+		t.Fatal(err)
+	}
+	history, err = l.UserHistory(u.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := history[0].User; h.HashedPassword != nil ||
+		h.ResetPasswordVerificationToken != nil {
+		t.Fatalf("secrets retained: %+v", h)
+	}
+
+	// History records must not show up as users.
+	var users int
+	err = l.AllUsers(func(u *database.User) {
+		users++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users != 1 {
+		t.Fatalf("expected 1 user, got %v", users)
+	}
+
+	_, err = l.UserHistory("missing@example.com")
+	if err != database.ErrUserNotFound {
+		t.Fatalf("expected %v, got %v", database.ErrUserNotFound, err)
+	}
+}
+
+func TestUserChangeEmail(t *testing.T) {
+	l, cleanup := newTestLocaldb(t)
+	defer cleanup()
+
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		err := l.UserNew(database.User{
+			Email:    email,
+			Username: email[:1],
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := l.UserChangeEmail("a@example.com", "b@example.com")
+	if err != database.ErrUserExists {
+		t.Fatalf("expected %v, got %v", database.ErrUserExists, err)
+	}
+	err = l.UserChangeEmail("missing@example.com", "c@example.com")
+	if err != database.ErrUserNotFound {
+		t.Fatalf("expected %v, got %v", database.ErrUserNotFound, err)
+	}
+
+	err = l.UserChangeEmail("a@example.com", "c@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.UserGet("a@example.com"); err != database.ErrUserNotFound {
+		t.Fatalf("expected %v, got %v", database.ErrUserNotFound, err)
+	}
+	u, err := l.UserGet("c@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Email != "c@example.com" || u.Username != "a" {
+		t.Fatalf("unexpected user %v", u)
+	}
+
+	history, err := l.UserHistory("c@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].User.Email != "a@example.com" {
+		t.Fatalf("unexpected history %v", history)
+	}
+
+	// No records may be left behind under the old email.
+	err = l.VerifyIntegrity(func(key string, err error) {
+		if err != nil {
+			t.Fatalf("%v: %v", key, err)
+		}
+		if strings.Contains(key, "a@example.com") {
+			t.Fatalf("stale record %v", key)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	l, cleanup := newTestLocaldb(t)
+	defer cleanup()
+
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		err := l.UserNew(database.User{
+			Email:    email,
+			Username: email[:1],
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	token := []byte{1, 2, 3}
+	u, err := l.UserGet("a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = database.ConfirmEmailChange(l, u, token, now)
+	if err != database.ErrEmailChangeNotFound || !database.IsNotFound(err) {
+		t.Fatalf("expected %v, got %v", database.ErrEmailChangeNotFound, err)
+	}
+
+	// The new email is taken when the change is confirmed.
+	err = database.StartEmailChange(u, "B@example.com", token,
+		now.Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.NewEmail != "b@example.com" {
+		t.Fatalf("new email not normalized: %v", u.NewEmail)
+	}
+	if err := database.ConfirmEmailChange(l, u, token, now); err != database.ErrUserExists {
+		t.Fatalf("expected %v, got %v", database.ErrUserExists, err)
+	}
+
+	err = database.StartEmailChange(u, "c@example.com", token,
+		now.Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.UserUpdate(*u); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.ConfirmEmailChange(l, u, []byte{1}, now); err != database.ErrEmailChangeTokenInvalid {
+		t.Fatalf("expected %v, got %v", database.ErrEmailChangeTokenInvalid, err)
+	}
+	later := now.Add(2 * time.Hour)
+	if err := database.ConfirmEmailChange(l, u, token, later); err != database.ErrEmailChangeTokenExpired {
+		t.Fatalf("expected %v, got %v", database.ErrEmailChangeTokenExpired, err)
+	}
+
+	if err := database.ConfirmEmailChange(l, u, token, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.UserGet("a@example.com"); err != database.ErrUserNotFound {
+		t.Fatalf("expected %v, got %v", database.ErrUserNotFound, err)
+	}
+	stored, err := l.UserGet("c@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.NewEmail != "" || stored.EmailChangeVerificationToken != nil ||
+		stored.EmailChangeVerificationExpiry != 0 {
+		t.Fatalf("pending change not cleared: %+v", stored)
+	}
+	if u.Email != "c@example.com" {
+		t.Fatalf("user not updated: %+v", u)
+	}
+}
+
+func TestUserPreferences(t *testing.T) {
+	l, cleanup := newTestLocaldb(t)
+	defer cleanup()
+
+	_, err := l.UserPreferencesGet(1)
+	if err != database.ErrPreferencesNotFound {
+		t.Fatalf("expected %v, got %v", database.ErrPreferencesNotFound, err)
+	}
+
+	p := database.UserPreferences{
+		UserID: 1,
+		Notifications: map[string]string{
+			"proposalstatus": database.NotifyImmediate,
+		},
+		Language: "en-US",
+	}
+	if err := l.UserPreferencesSave(p); err != nil {
+		t.Fatal(err)
+	}
+	p.Language = "pt-BR"
+	if err := l.UserPreferencesSave(p); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := l.UserPreferencesGet(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Language != "pt-BR" ||
+		got.Notifications["proposalstatus"] != database.NotifyImmediate {
+		t.Fatalf("unexpected preferences %+v", got)
+	}
+
+	// Preferences are not user records.
+	err = l.AllUsers(func(u *database.User) {
+		t.Fatalf("unexpected user %v", u.Email)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l.VerifyIntegrity(func(key string, err error) {
+		if err != nil {
+			t.Fatalf("%v: %v", key, err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvitations(t *testing.T) {
+	l, cleanup := newTestLocaldb(t)
+	defer cleanup()
+
+	now := time.Now()
+	token, i, err := database.NewInvitation("Invitee@example.com", 1, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Email != "invitee@example.com" {
+		t.Fatalf("email not normalized: %v", i.Email)
+	}
+	if err := l.InviteNew(*i); err != nil {
+		t.Fatal(err)
+	}
+
+	// An expired invitation can't be redeemed.
+	expiredToken, expired, err := database.NewInvitation("old@example.com",
+		1, now.Add(-database.InviteExpiry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.InviteNew(*expired); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.InviteGet(expiredToken); err != database.ErrInviteExpired {
+		t.Fatalf("expected %v, got %v", database.ErrInviteExpired, err)
+	}
+
+	if _, err := l.InviteGet([]byte("wrong")); err != database.ErrInviteNotFound {
+		t.Fatalf("expected %v, got %v", database.ErrInviteNotFound, err)
+	}
+	got, err := l.InviteGet(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Email != i.Email || got.InviterID != 1 {
+		t.Fatalf("unexpected invitation %+v", got)
+	}
+
+	// An invitation can only be redeemed once.
+	if err := l.InviteRedeem(token, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.InviteRedeem(token, 3); err != database.ErrInviteRedeemed {
+		t.Fatalf("expected %v, got %v", database.ErrInviteRedeemed, err)
+	}
+
+	var n int
+	err = l.AllInvites(func(i *database.Invitation) {
+		n++
+		if i.Email == "invitee@example.com" && (i.RedeemedBy != 2 ||
+			i.RedeemedAt == 0) {
+			t.Fatalf("invitation not redeemed: %+v", i)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("got %v invitations, expected 2", n)
+	}
+
+	// Invitations are not user records.
+	err = l.AllUsers(func(u *database.User) {
+		t.Fatalf("unexpected user %v", u.Email)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l.VerifyIntegrity(func(key string, err error) {
+		if err != nil {
+			t.Fatalf("%v: %v", key, err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	l, cleanup := newTestLocaldb(t)
+	defer cleanup()
+
+	// Database errors are returned as is.
+	_, err := l.UserGet("missing@example.com")
+	if err != database.ErrUserNotFound || !database.IsNotFound(err) {
+		t.Fatalf("expected %v, got %v", database.ErrUserNotFound, err)
+	}
+	if database.IsBackend(err) {
+		t.Fatalf("database error was wrapped")
+	}
+
+	// Errors of the underlying store are wrapped without leaking the key.
+	email := "user@example.com"
+	err = l.userdb.Put([]byte(email), []byte("garbage"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = l.UserGet(email)
+	e, ok := err.(*database.Error)
+	if !ok {
+		t.Fatalf("expected *database.Error, got %T %v", err, err)
+	}
+	if e.Backend != backendName || e.Op != "UserGet" ||
+		e.Key != database.HashKey(email) {
+		t.Fatalf("unexpected error %+v", e)
+	}
+	if strings.Contains(err.Error(), email) {
+		t.Fatalf("error leaks the key: %v", err)
+	}
+	if database.IsNotFound(err) || database.Cause(err) != e.Err {
+		t.Fatalf("unexpected cause %v", database.Cause(err))
+	}
+
+	l.Close()
+	_, err = l.UserGet(email)
+	if !database.IsShutdown(err) {
+		t.Fatalf("expected %v, got %v", database.ErrShutdown, err)
+	}
+}
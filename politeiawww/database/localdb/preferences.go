@@ -0,0 +1,65 @@
+package localdb
+
+import (
+	"strconv"
+
+	"github.com/decred/politeia/politeiawww/database"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// preferencesKey returns the key of the preferences of a user.
+func preferencesKey(userID uint64) string {
+	return PreferencesPrefix + strconv.FormatUint(userID, 10)
+}
+
+// UserPreferencesGet returns the preferences of a user.
+//
+// UserPreferencesGet satisfies the backend interface.
+func (l *localdb) UserPreferencesGet(userID uint64) (*database.UserPreferences, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return nil, database.ErrShutdown
+	}
+
+	log.Debugf("UserPreferencesGet: %v", userID)
+
+	key := preferencesKey(userID)
+	payload, err := l.userdb.Get([]byte(key), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, database.ErrPreferencesNotFound
+	} else if err != nil {
+		return nil, wrapErr("UserPreferencesGet", key, err)
+	}
+
+	p, err := DecodeUserPreferences(payload)
+	if err != nil {
+		return nil, wrapErr("UserPreferencesGet", key, err)
+	}
+
+	return p, nil
+}
+
+// UserPreferencesSave creates or updates the preferences of a user.
+//
+// UserPreferencesSave satisfies the backend interface.
+func (l *localdb) UserPreferencesSave(p database.UserPreferences) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return database.ErrShutdown
+	}
+
+	log.Debugf("UserPreferencesSave: %v", p.UserID)
+
+	key := preferencesKey(p.UserID)
+	payload, err := EncodeUserPreferences(p)
+	if err != nil {
+		return wrapErr("UserPreferencesSave", key, err)
+	}
+
+	return wrapErr("UserPreferencesSave", key,
+		l.userdb.Put([]byte(key), payload, nil))
+}
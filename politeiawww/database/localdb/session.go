@@ -0,0 +1,152 @@
+package localdb
+
+import (
+	"time"
+
+	"github.com/decred/politeia/politeiawww/database"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// sessionExpired returns whether the session has expired.
+func sessionExpired(s *database.Session) bool {
+	return s.Expiry != 0 && time.Now().Unix() >= s.Expiry
+}
+
+// deleteSessions deletes all sessions for which the filter function returns
+// true.
+//
+// This function must be called with the lock held.
+func (l *localdb) deleteSessions(filter func(s *database.Session) bool) (int, error) {
+	batch := new(leveldb.Batch)
+	iter := l.userdb.NewIterator(util.BytesPrefix([]byte(SessionPrefix)), nil)
+	for iter.Next() {
+		s, err := DecodeSession(iter.Value())
+		if err != nil {
+			iter.Release()
+			return 0, err
+		}
+		if filter(s) {
+			batch.Delete(append([]byte{}, iter.Key()...))
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+
+	if batch.Len() == 0 {
+		return 0, nil
+	}
+
+	return batch.Len(), l.userdb.Write(batch, nil)
+}
+
+// pruneSessions removes all expired sessions.
+//
+// This function must be called with the lock held.
+func (l *localdb) pruneSessions() error {
+	n, err := l.deleteSessions(sessionExpired)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("pruneSessions: %v expired sessions", n)
+
+	return nil
+}
+
+// SessionSave creates or updates a session.
+//
+// SessionSave satisfies the backend interface.
+func (l *localdb) SessionSave(s database.Session) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return database.ErrShutdown
+	}
+
+	log.Debugf("SessionSave: %v", database.HashKey(s.ID))
+
+	payload, err := EncodeSession(s)
+	if err != nil {
+		return wrapErr("SessionSave", s.ID, err)
+	}
+
+	err = l.userdb.Put([]byte(SessionPrefix+s.ID), payload, nil)
+	return wrapErr("SessionSave", s.ID, err)
+}
+
+// SessionGetByID returns a session if found in the database and not expired.
+//
+// SessionGetByID satisfies the backend interface.
+func (l *localdb) SessionGetByID(id string) (*database.Session, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return nil, database.ErrShutdown
+	}
+
+	log.Debugf("SessionGetByID: %v", database.HashKey(id))
+
+	payload, err := l.userdb.Get([]byte(SessionPrefix+id), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, database.ErrSessionNotFound
+	} else if err != nil {
+		return nil, wrapErr("SessionGetByID", id, err)
+	}
+
+	s, err := DecodeSession(payload)
+	if err != nil {
+		return nil, wrapErr("SessionGetByID", id, err)
+	}
+
+	if sessionExpired(s) {
+		err = l.userdb.Delete([]byte(SessionPrefix+id), nil)
+		if err != nil {
+			return nil, wrapErr("SessionGetByID", id, err)
+		}
+		return nil, database.ErrSessionNotFound
+	}
+
+	return s, nil
+}
+
+// SessionDeleteByID deletes a session.  Deleting a session that does not
+// exist is not an error.
+//
+// SessionDeleteByID satisfies the backend interface.
+func (l *localdb) SessionDeleteByID(id string) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return database.ErrShutdown
+	}
+
+	log.Debugf("SessionDeleteByID: %v", database.HashKey(id))
+
+	err := l.userdb.Delete([]byte(SessionPrefix+id), nil)
+	return wrapErr("SessionDeleteByID", id, err)
+}
+
+// SessionsDeleteByUserID deletes all sessions that belong to the given user.
+//
+// SessionsDeleteByUserID satisfies the backend interface.
+func (l *localdb) SessionsDeleteByUserID(userID uint64) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.shutdown {
+		return database.ErrShutdown
+	}
+
+	log.Debugf("SessionsDeleteByUserID: %v", userID)
+
+	_, err := l.deleteSessions(func(s *database.Session) bool {
+		return s.UserID == userID
+	})
+	return wrapErr("SessionsDeleteByUserID", "", err)
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2017 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"time"
+)
+
+// LockReasonFailedLogins is the lock reason of users that were locked by
+// RecordFailedLogin.
+const LockReasonFailedLogins = "too many failed login attempts"
+
+// LockoutPolicy determines when a user is locked out after failed logins.
+type LockoutPolicy struct {
+	MaxFailedLogins uint64        // Failed logins in a row that lock the user, 0 never locks
+	LockDuration    time.Duration // How long a lock lasts, 0 until it is reset
+}
+
+// lockExpired returns whether the user was locked for a limited time and
+// that time has passed.
+func (p LockoutPolicy) lockExpired(u *User, now time.Time) bool {
+	return p.LockDuration != 0 && u.LockedUntil != 0 &&
+		now.Unix() >= u.LockedUntil
+}
+
+// IsLocked returns whether the user is locked out at the given time.
+func (p LockoutPolicy) IsLocked(u *User, now time.Time) bool {
+	if p.MaxFailedLogins == 0 || u.FailedLoginAttempts < p.MaxFailedLogins {
+		return false
+	}
+	return !p.lockExpired(u, now)
+}
+
+// RecordFailedLogin records a failed login of the user and returns true if
+// the user is locked out by this attempt.  Attempts are not counted while
+// the user is locked.  Once a limited lock has expired the count starts
+// over.  The caller must store the user.
+func (p LockoutPolicy) RecordFailedLogin(u *User, now time.Time) bool {
+	if p.lockExpired(u, now) {
+		ResetFailedLogins(u)
+	}
+	if p.IsLocked(u, now) {
+		return false
+	}
+
+	u.FailedLoginAttempts++
+	if !p.IsLocked(u, now) {
+		return false
+	}
+
+	u.LockReason = LockReasonFailedLogins
+	if p.LockDuration != 0 {
+		u.LockedUntil = now.Add(p.LockDuration).Unix()
+	}
+	return true
+}
+
+// ResetFailedLogins clears the failed logins of the user and unlocks it, e.g.
+// after a successful login or a password reset.  The caller must store the
+// user.
+func ResetFailedLogins(u *User) {
+	u.FailedLoginAttempts = 0
+	u.LockedUntil = 0
+	u.LockReason = ""
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicy(t *testing.T) {
+	now := time.Unix(1530000000, 0)
+	p := LockoutPolicy{MaxFailedLogins: 3}
+
+	var u User
+	for i := 1; i < 3; i++ {
+		if p.RecordFailedLogin(&u, now) {
+			t.Fatalf("attempt %v: unexpected lock", i)
+		}
+		if p.IsLocked(&u, now) {
+			t.Fatalf("attempt %v: user is locked", i)
+		}
+	}
+	if !p.RecordFailedLogin(&u, now) {
+		t.Fatalf("third attempt didn't lock the user")
+	}
+	if !p.IsLocked(&u, now) || u.LockReason != LockReasonFailedLogins {
+		t.Fatalf("user not locked: %+v", u)
+	}
+
+	// Without a lock duration the user stays locked and further attempts
+	// are not counted.
+	later := now.Add(365 * 24 * time.Hour)
+	if p.RecordFailedLogin(&u, later) || u.FailedLoginAttempts != 3 {
+		t.Fatalf("attempt counted while locked: %+v", u)
+	}
+	if !p.IsLocked(&u, later) {
+		t.Fatalf("lock expired")
+	}
+
+	ResetFailedLogins(&u)
+	if p.IsLocked(&u, now) || u.FailedLoginAttempts != 0 ||
+		u.LockReason != "" {
+		t.Fatalf("user not unlocked: %+v", u)
+	}
+}
+
+func TestLockoutPolicyDuration(t *testing.T) {
+	now := time.Unix(1530000000, 0)
+	p := LockoutPolicy{
+		MaxFailedLogins: 2,
+		LockDuration:    time.Hour,
+	}
+
+	var u User
+	p.RecordFailedLogin(&u, now)
+	if !p.RecordFailedLogin(&u, now) {
+		t.Fatalf("user not locked")
+	}
+	if u.LockedUntil != now.Add(time.Hour).Unix() {
+		t.Fatalf("got locked until %v, expected %v", u.LockedUntil,
+			now.Add(time.Hour).Unix())
+	}
+	if !p.IsLocked(&u, now.Add(time.Hour-time.Second)) {
+		t.Fatalf("lock expired early")
+	}
+
+	// The lock expires and the count starts over.
+	expired := now.Add(time.Hour)
+	if p.IsLocked(&u, expired) {
+		t.Fatalf("lock didn't expire")
+	}
+	if p.RecordFailedLogin(&u, expired) {
+		t.Fatalf("unexpected lock after expiry")
+	}
+	if u.FailedLoginAttempts != 1 || u.LockedUntil != 0 {
+		t.Fatalf("count didn't start over: %+v", u)
+	}
+	if !p.RecordFailedLogin(&u, expired) {
+		t.Fatalf("user not locked again")
+	}
+}
+
+func TestLockoutPolicyDisabled(t *testing.T) {
+	var (
+		p LockoutPolicy
+		u User
+	)
+	now := time.Unix(1530000000, 0)
+	for i := 0; i < 10; i++ {
+		if p.RecordFailedLogin(&u, now) || p.IsLocked(&u, now) {
+			t.Fatalf("user locked with lockout disabled")
+		}
+	}
+	if u.FailedLoginAttempts != 10 {
+		t.Fatalf("got %v failed logins, expected 10",
+			u.FailedLoginAttempts)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2017 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const (
+	// TOTPPeriod is the time step of the one-time passwords (RFC 6238).
+	TOTPPeriod = 30 * time.Second
+
+	// TOTPDigits is the number of digits of a one-time password.
+	TOTPDigits = 6
+
+	// TOTPSecretSize is the size of a TOTP secret in bytes.
+	TOTPSecretSize = 20
+
+	// TOTPRecoveryCodes is the number of recovery codes that are created
+	// on enrollment.  Each code can be used once instead of a one-time
+	// password.
+	TOTPRecoveryCodes = 10
+
+	// totpSkew is the number of time steps before and after the current
+	// one that are accepted to allow for clock drift.
+	totpSkew = 1
+
+	// nonceSize is the size of the secretbox nonce that is prepended to
+	// the encrypted secret.
+	nonceSize = 24
+)
+
+// errTOTPSecret is returned when the stored TOTP secret can't be decrypted,
+// e.g. because the wrong key was used.
+var errTOTPSecret = errors.New("invalid TOTP secret")
+
+// TOTP holds the time-based one-time password two-factor authentication
+// settings of a user.
+type TOTP struct {
+	Secret        []byte   // Secret encrypted with secretbox, nonce prepended
+	Confirmed     bool     // Whether the user has entered a valid code
+	RecoveryCodes [][]byte // SHA256 hashes of the unused recovery codes
+	LastStep      int64    // Time step of the last accepted code
+	Enrolled      int64    // Unix timestamp of the enrollment
+}
+
+// totpCode returns the one-time password of the secret for the time step.
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	h := hmac.New(sha1.New, secret)
+	h.Write(msg[:])
+	sum := h.Sum(nil)
+
+	// Dynamic truncation, RFC 4226 section 5.3.
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, code%mod)
+}
+
+// totpStep returns the time step of t.
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod/time.Second)
+}
+
+// normalizeRecoveryCode removes the formatting of a recovery code that was
+// entered by a user.
+func normalizeRecoveryCode(code string) string {
+	code = strings.Replace(code, "-", "", -1)
+	code = strings.Replace(code, " ", "", -1)
+	return strings.ToLower(code)
+}
+
+// hashRecoveryCode returns the hash under which a recovery code is stored.
+func hashRecoveryCode(code string) []byte {
+	h := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return h[:]
+}
+
+// EnrollTOTP creates a new TOTP secret and recovery codes for the user.  The
+// secret is stored encrypted with key and returned in plain text so that it
+// can be shown to the user along with the recovery codes, which are only
+// stored as hashes.  The enrollment has to be confirmed with VerifyTOTP.  An
+// unconfirmed enrollment is replaced.  The caller must store the user.
+func EnrollTOTP(u *User, key *[32]byte, now time.Time) ([]byte, []string, error) {
+	if u.TOTP != nil && u.TOTP.Confirmed {
+		return nil, nil, ErrTOTPEnrolled
+	}
+
+	secret := make([]byte, TOTPSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, nil, err
+	}
+	var nonce [nonceSize]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, nil, err
+	}
+
+	codes := make([]string, 0, TOTPRecoveryCodes)
+	hashes := make([][]byte, 0, TOTPRecoveryCodes)
+	for i := 0; i < TOTPRecoveryCodes; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes = append(codes, code[:4]+"-"+code[4:])
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	u.TOTP = &TOTP{
+		Secret:        secretbox.Seal(nonce[:], secret, &nonce, key),
+		RecoveryCodes: hashes,
+		Enrolled:      now.Unix(),
+	}
+	return secret, codes, nil
+}
+
+// decryptTOTPSecret returns the plain text TOTP secret of the user.
+func decryptTOTPSecret(t *TOTP, key *[32]byte) ([]byte, error) {
+	if len(t.Secret) < nonceSize {
+		return nil, errTOTPSecret
+	}
+	var nonce [nonceSize]byte
+	copy(nonce[:], t.Secret)
+	secret, ok := secretbox.Open(nil, t.Secret[nonceSize:], &nonce, key)
+	if !ok {
+		return nil, errTOTPSecret
+	}
+	return secret, nil
+}
+
+// VerifyTOTP returns whether code is a valid one-time password or unused
+// recovery code of the user.  The first valid one-time password confirms the
+// enrollment.  A one-time password can't be used twice and a recovery code is
+// removed once it is used, so the caller must store the user when true is
+// returned.  Recovery codes are only accepted once the enrollment has been
+// confirmed.
+func VerifyTOTP(u *User, key *[32]byte, code string, now time.Time) (bool, error) {
+	if u.TOTP == nil {
+		return false, ErrTOTPNotEnrolled
+	}
+
+	secret, err := decryptTOTPSecret(u.TOTP, key)
+	if err != nil {
+		return false, err
+	}
+
+	current := totpStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= u.TOTP.LastStep {
+			continue
+		}
+		if hmac.Equal([]byte(totpCode(secret, step)), []byte(code)) {
+			u.TOTP.LastStep = step
+			u.TOTP.Confirmed = true
+			return true, nil
+		}
+	}
+
+	if !u.TOTP.Confirmed {
+		return false, nil
+	}
+	hash := hashRecoveryCode(code)
+	for i, h := range u.TOTP.RecoveryCodes {
+		if hmac.Equal(h, hash) {
+			u.TOTP.RecoveryCodes = append(u.TOTP.RecoveryCodes[:i],
+				u.TOTP.RecoveryCodes[i+1:]...)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// RevokeTOTP removes the two-factor authentication of the user, e.g. when
+// the user disables it or has lost both the device and the recovery codes.
+// The caller must store the user.
+func RevokeTOTP(u *User) error {
+	if u.TOTP == nil {
+		return ErrTOTPNotEnrolled
+	}
+	u.TOTP = nil
+	return nil
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits.
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		time int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, test := range tests {
+		code := totpCode(secret, totpStep(time.Unix(test.time, 0)))
+		if code != test.code {
+			t.Fatalf("time %v: got %v, expected %v", test.time, code,
+				test.code)
+		}
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	var key [32]byte
+	copy(key[:], "0123456789abcdef0123456789abcdef")
+	now := time.Unix(1530000000, 0)
+
+	var u User
+	if _, err := VerifyTOTP(&u, &key, "000000", now); err != ErrTOTPNotEnrolled {
+		t.Fatalf("got %v, expected %v", err, ErrTOTPNotEnrolled)
+	}
+
+	secret, codes, err := EnrollTOTP(&u, &key, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != TOTPRecoveryCodes {
+		t.Fatalf("got %v recovery codes", len(codes))
+	}
+	if strings.Contains(string(u.TOTP.Secret), string(secret)) {
+		t.Fatalf("secret stored in plain text")
+	}
+
+	// Recovery codes can't be used before the enrollment is confirmed.
+	ok, err := VerifyTOTP(&u, &key, codes[0], now)
+	if err != nil || ok {
+		t.Fatalf("recovery code accepted before confirmation: %v %v", ok,
+			err)
+	}
+
+	code := totpCode(secret, totpStep(now))
+	ok, err = VerifyTOTP(&u, &key, code, now)
+	if err != nil || !ok || !u.TOTP.Confirmed {
+		t.Fatalf("valid code rejected: %v %v", ok, err)
+	}
+	if _, _, err := EnrollTOTP(&u, &key, now); err != ErrTOTPEnrolled {
+		t.Fatalf("got %v, expected %v", err, ErrTOTPEnrolled)
+	}
+
+	// A code can't be reused.
+	if ok, _ := VerifyTOTP(&u, &key, code, now); ok {
+		t.Fatalf("code reused")
+	}
+
+	// The next code is accepted within the allowed clock drift.
+	next := totpCode(secret, totpStep(now)+1)
+	if ok, _ := VerifyTOTP(&u, &key, next, now); !ok {
+		t.Fatalf("code of the next step rejected")
+	}
+	old := totpCode(secret, totpStep(now)-5)
+	if ok, _ := VerifyTOTP(&u, &key, old, now); ok {
+		t.Fatalf("old code accepted")
+	}
+
+	// Recovery codes are accepted once, in any case and formatting.
+	entered := strings.ToUpper(strings.Replace(codes[1], "-", " ", 1))
+	if ok, _ := VerifyTOTP(&u, &key, entered, now); !ok {
+		t.Fatalf("recovery code rejected")
+	}
+	if ok, _ := VerifyTOTP(&u, &key, codes[1], now); ok {
+		t.Fatalf("recovery code reused")
+	}
+	if len(u.TOTP.RecoveryCodes) != TOTPRecoveryCodes-1 {
+		t.Fatalf("got %v recovery codes", len(u.TOTP.RecoveryCodes))
+	}
+
+	// The secret can't be decrypted with another key.
+	var wrong [32]byte
+	if _, err := VerifyTOTP(&u, &wrong, code, now); err != errTOTPSecret {
+		t.Fatalf("got %v, expected %v", err, errTOTPSecret)
+	}
+
+	if err := RevokeTOTP(&u); err != nil || u.TOTP != nil {
+		t.Fatalf("not revoked: %v", err)
+	}
+	if err := RevokeTOTP(&u); err != ErrTOTPNotEnrolled || !IsNotFound(err) {
+		t.Fatalf("got %v, expected %v", err, ErrTOTPNotEnrolled)
+	}
+}
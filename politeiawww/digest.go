@@ -0,0 +1,215 @@
+// Copyright (c) 2017 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	www "github.com/decred/politeia/politeiawww/api/v1"
+	"github.com/decred/politeia/politeiawww/database"
+)
+
+const (
+	// adminDigestSchedule determines when the admin digest is sent.
+	adminDigestSchedule = "0 0 0 * * *" // Every day at midnight
+
+	// adminDigestPeriod is the amount of time covered by a digest.
+	adminDigestPeriod = 24 * time.Hour
+)
+
+// adminDigest summarizes the activity on the server over a period of time so
+// that admins get a single operational overview per day.
+type adminDigest struct {
+	Since             time.Time
+	Until             time.Time
+	NewUsers          []string // Usernames of users that registered
+	UnpaidUsers       int      // Users that have not paid the registration fee
+	UserPayments      int      // Registration fees paid
+	CreditsPurchased  int      // Proposal credits purchased
+	CreditPayments    int      // Distinct txs used to purchase proposal credits
+	ProposalsUnvetted int      // Proposals pending admin review
+	ProposalsPublic   int      // Public proposals
+	ProposalsCensored int      // Censored proposals
+	AuditEntries      int      // Changes recorded in the audit log
+	AuditActions      []digestAuditAction
+
+	creditPaymentTxIDs map[string]struct{} // Used to count CreditPayments
+}
+
+// digestAuditAction is the number of audit log entries of an action within
+// the digest window.
+type digestAuditAction struct {
+	Action string
+	Count  int
+}
+
+// inWindow returns whether the unix timestamp falls within the period covered
+// by the digest.
+func (d *adminDigest) inWindow(t int64) bool {
+	return t >= d.Since.Unix() && t < d.Until.Unix()
+}
+
+// addUser adds the activity of a single user to the digest.
+func (d *adminDigest) addUser(b *backend, u *database.User) {
+	if len(u.Identities) > 0 && d.inWindow(u.Identities[0].Activated) {
+		d.NewUsers = append(d.NewUsers, u.Username)
+	}
+
+	if !b.HasUserPaid(u) {
+		d.UnpaidUsers++
+	}
+	// Paywalls that were cleared by an admin have no payment time.
+	if d.inWindow(u.NewUserPaywallTxTime) {
+		d.UserPayments++
+	}
+
+	d.addCredits(u.UnspentProposalCredits)
+	d.addCredits(u.SpentProposalCredits)
+}
+
+// addCredits adds the proposal credits that were purchased during the digest
+// window to the digest.  Credits that were granted with politeiawww_dbutil
+// were not purchased.
+func (d *adminDigest) addCredits(credits []database.ProposalCredit) {
+	for _, c := range credits {
+		if !d.inWindow(c.DatePurchased) ||
+			c.TxID == database.ManualCreditTxID {
+			continue
+		}
+		d.CreditsPurchased++
+		d.creditPaymentTxIDs[c.TxID] = struct{}{}
+	}
+}
+
+// addAuditLog adds a summary of the audit log entries that were recorded
+// during the digest window to the digest.  Actions are sorted by name.
+func (d *adminDigest) addAuditLog(db database.Database) error {
+	counts := make(map[string]int)
+	err := db.AuditLog(d.Since.Unix(), d.Until.Unix(),
+		func(a *database.AuditEntry) {
+			d.AuditEntries++
+			counts[a.Action]++
+		})
+	if err != nil {
+		return err
+	}
+
+	for action, count := range counts {
+		d.AuditActions = append(d.AuditActions, digestAuditAction{
+			Action: action,
+			Count:  count,
+		})
+	}
+	sort.Slice(d.AuditActions, func(i, j int) bool {
+		return d.AuditActions[i].Action < d.AuditActions[j].Action
+	})
+
+	return nil
+}
+
+// generateAdminDigest compiles the admin digest for the given time window.
+func (b *backend) generateAdminDigest(since, until time.Time) (*adminDigest, error) {
+	d := adminDigest{
+		Since:              since,
+		Until:              until,
+		creditPaymentTxIDs: make(map[string]struct{}),
+	}
+
+	err := b.db.AllUsers(func(u *database.User) {
+		d.addUser(b, u)
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.CreditPayments = len(d.creditPaymentTxIDs)
+
+	err = d.addAuditLog(b.db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.LoadInventory()
+	if err != nil {
+		return nil, err
+	}
+
+	b.RLock()
+	for _, ir := range b.inventory {
+		switch convertPropStatusFromPD(ir.record.Status) {
+		case www.PropStatusNotReviewed, www.PropStatusUnreviewedChanges:
+			d.ProposalsUnvetted++
+		case www.PropStatusPublic:
+			d.ProposalsPublic++
+		case www.PropStatusCensored:
+			d.ProposalsCensored++
+		}
+	}
+	b.RUnlock()
+
+	return &d, nil
+}
+
+// emailAdminDigest sends the admin digest to every admin if the email server
+// is set up.
+func (b *backend) emailAdminDigest(d *adminDigest) error {
+	if b.cfg.SMTP == nil {
+		return nil
+	}
+
+	var admins []string
+	err := b.db.AllUsers(func(u *database.User) {
+		if u.Admin {
+			admins = append(admins, u.Email)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if len(admins) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	err = templateAdminDigestEmail.Execute(&buf, d)
+	if err != nil {
+		return err
+	}
+	subject := fmt.Sprintf("Politeia Digest %v", d.Until.Format("2006-01-02"))
+	body := buf.String()
+
+	return b.enqueueEmail(subject, body, nil, admins)
+}
+
+// stopAdminDigest stops scheduling the admin digest.  A digest that is being
+// generated is not interrupted.
+func (b *backend) stopAdminDigest() {
+	if b.cron != nil {
+		b.cron.Stop()
+	}
+}
+
+// adminDigestCronJob is the cron job that generates and sends the admin
+// digest for the previous period.
+func (b *backend) adminDigestCronJob() {
+	until := time.Now()
+	d, err := b.generateAdminDigest(until.Add(-adminDigestPeriod), until)
+	if err != nil {
+		log.Errorf("generateAdminDigest: %v", err)
+		return
+	}
+
+	log.Infof("Admin digest: %v new users, %v proposal credits purchased, "+
+		"%v proposals pending review, %v audit log entries",
+		len(d.NewUsers), d.CreditsPurchased, d.ProposalsUnvetted,
+		d.AuditEntries)
+
+	err = b.emailAdminDigest(d)
+	if err != nil {
+		log.Errorf("emailAdminDigest: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"time"
+
+	"github.com/dajohi/goemail"
+	"github.com/decred/politeia/politeiawww/database"
+)
+
+const (
+	// emailFromAddress is the sender address of all politeiawww emails.
+	emailFromAddress = "noreply@decred.org"
+
+	// emailQueueCheckGap is the amount of time the email worker sleeps when
+	// there are no emails that are due for delivery.
+	emailQueueCheckGap = time.Second * 5
+)
+
+// enqueueEmail persists an email in the database so that it is delivered by
+// the email queue worker.  Queued emails survive restarts and are retried
+// when the email server is unavailable.
+func (b *backend) enqueueEmail(subject, body string, to, bcc []string) error {
+	id, err := b.db.EmailEnqueue(database.QueuedEmail{
+		To:      to,
+		BCC:     bcc,
+		Subject: subject,
+		Body:    body,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Queued email %v: %v", id, subject)
+	return nil
+}
+
+// sendQueuedEmail delivers a queued email through the email server.
+func (b *backend) sendQueuedEmail(e *database.QueuedEmail) error {
+	msg := goemail.NewHTMLMessage(emailFromAddress, e.Subject, e.Body)
+	for _, to := range e.To {
+		msg.AddTo(to)
+	}
+	for _, bcc := range e.BCC {
+		msg.AddBCC(bcc)
+	}
+
+	msg.SetName(politeiaMailName)
+	return b.cfg.SMTP.Send(msg)
+}
+
+// drainEmailQueue delivers the queued emails that are due until the queue is
+// empty.  It returns false if the database has been shut down.
+func (b *backend) drainEmailQueue() bool {
+	for {
+		e, err := b.db.EmailClaim()
+		if err != nil {
+			switch err {
+			case database.ErrEmailQueueEmpty:
+				return true
+			case database.ErrShutdown:
+				// The database is shutdown, so stop the thread.
+				return false
+			}
+
+			log.Errorf("cannot claim queued email: %v", err)
+			return true
+		}
+
+		sendErr := b.sendQueuedEmail(e)
+		if sendErr == nil {
+			err = b.db.EmailMarkSent(e.ID)
+		} else {
+			log.Errorf("cannot send email %v (attempt %v): %v", e.ID,
+				e.Attempts+1, sendErr)
+			err = b.db.EmailRetry(e.ID, sendErr)
+		}
+		if err != nil {
+			if err == database.ErrShutdown {
+				return false
+			}
+
+			log.Errorf("cannot update queued email %v: %v", e.ID, err)
+		}
+	}
+}
+
+// emailQueueWorker delivers queued emails until the database is shut down.
+func (b *backend) emailQueueWorker() {
+	for {
+		if !b.drainEmailQueue() {
+			return
+		}
+
+		time.Sleep(emailQueueCheckGap)
+	}
+}
+
+// initEmailQueue starts the email queue worker if the email server is set
+// up.
+func (b *backend) initEmailQueue() {
+	if b.cfg.SMTP == nil {
+		return
+	}
+
+	go b.emailQueueWorker()
+}
@@ -6,6 +6,7 @@ import (
 
 	v1 "github.com/decred/politeia/politeiawww/api/v1"
 	"github.com/decred/politeia/politeiawww/database"
+	"github.com/decred/politeia/politeiawww/paywall"
 	"github.com/decred/politeia/util"
 )
 
@@ -73,8 +74,7 @@ func (b *backend) addUserToPaywallPoolLock(user *database.User, paywallType stri
 }
 
 func (b *backend) updateUserAsPaid(user *database.User, tx string) error {
-	user.NewUserPaywallTx = tx
-	user.NewUserPaywallPollExpiry = 0
+	paywall.MarkUserPaid(user, tx, time.Now().Unix())
 	return b.db.UserUpdate(*user)
 }
 
@@ -137,16 +137,19 @@ func (b *backend) checkForUserPayments(pool map[uint64]paywallPoolMember) (bool,
 			continue
 		}
 
-		tx, _, err := util.FetchTxWithBlockExplorers(poolMember.address, poolMember.amount,
-			poolMember.txNotBefore, b.cfg.MinConfirmationsRequired)
+		payment, err := b.paymentProcessor.FetchPayment(paywall.Paywall{
+			Address:     poolMember.address,
+			Amount:      poolMember.amount,
+			TxNotBefore: poolMember.txNotBefore,
+		}, b.cfg.MinConfirmationsRequired)
 		if err != nil {
 			log.Errorf("cannot fetch tx: %v\n", err)
 			continue
 		}
 
-		if tx != "" {
+		if payment != nil {
 			// Update the user in the database.
-			err = b.updateUserAsPaid(user, tx)
+			err = b.updateUserAsPaid(user, payment.TxID)
 			if err != nil {
 				if err == database.ErrShutdown {
 					// The database is shutdown, so stop the thread.
@@ -193,8 +196,8 @@ func (b *backend) checkForProposalPayments(pool map[uint64]paywallPoolMember) (b
 
 		log.Tracef("Checking proposal paywall address for user %v...", user.Email)
 
-		paywall := b.mostRecentProposalPaywall(user)
-		if paywallHasExpired(paywall.PollExpiry) {
+		p := b.mostRecentProposalPaywall(user)
+		if paywallHasExpired(p.PollExpiry) {
 			userIDsToRemove = append(userIDsToRemove, userID)
 			log.Tracef("  removing from polling, poll has expired")
 			continue
@@ -309,11 +312,10 @@ func (b *backend) ProcessVerifyUserPayment(user *database.User, vupt v1.VerifyUs
 		return &reply, nil
 	}
 
-	tx, _, err := util.FetchTxWithBlockExplorers(user.NewUserPaywallAddress,
-		user.NewUserPaywallAmount, user.NewUserPaywallTxNotBefore,
+	payment, err := b.paymentProcessor.FetchPayment(paywall.UserPaywall(user),
 		b.cfg.MinConfirmationsRequired)
 	if err != nil {
-		if err == util.ErrCannotVerifyPayment {
+		if err == paywall.ErrCannotVerifyPayment {
 			return nil, v1.UserError{
 				ErrorCode: v1.ErrorStatusCannotVerifyPayment,
 			}
@@ -321,10 +323,10 @@ func (b *backend) ProcessVerifyUserPayment(user *database.User, vupt v1.VerifyUs
 		return nil, err
 	}
 
-	if tx != "" {
+	if payment != nil {
 		reply.HasPaid = true
 
-		err = b.updateUserAsPaid(user, tx)
+		err = b.updateUserAsPaid(user, payment.TxID)
 		if err != nil {
 			return nil, err
 		}
@@ -487,41 +489,32 @@ func (b *backend) ProcessProposalPaywallDetails(user *database.User) (*v1.Propos
 // requirements to purchase proposal credits.  If so, proposal credits are
 // created and the user database is updated.
 func (b *backend) verifyProposalPayment(user *database.User) error {
-	paywall := b.mostRecentProposalPaywall(user)
+	p := b.mostRecentProposalPaywall(user)
 
 	// If a TxID exists, the payment has already been verified.
-	if paywall.TxID != "" {
+	if p.TxID != "" {
 		return nil
 	}
 
 	// Check paywall address for tx.
-	txID, txAmount, err := util.FetchTxWithBlockExplorers(paywall.Address,
-		paywall.CreditPrice, paywall.TxNotBefore, b.cfg.MinConfirmationsRequired)
+	payment, err := b.paymentProcessor.FetchPayment(paywall.ProposalPaywall(p),
+		b.cfg.MinConfirmationsRequired)
 	if err != nil {
 		return fmt.Errorf("cannot fetch tx: %v\n", err)
 	}
 
-	if txID != "" {
-		paywall.TxID = txID
-		paywall.TxAmount = txAmount
-		paywall.NumCredits = txAmount / paywall.CreditPrice
-
+	if payment != nil {
 		// Create proposal credits.
-		c := make([]database.ProposalCredit, paywall.NumCredits)
-		timestamp := time.Now().Unix()
-		for i := uint64(0); i < paywall.NumCredits; i++ {
-			c[i] = database.ProposalCredit{
-				PaywallID:     paywall.ID,
-				Price:         paywall.CreditPrice,
-				DatePurchased: timestamp,
-				TxID:          paywall.TxID,
-			}
-		}
-		user.UnspentProposalCredits = append(user.UnspentProposalCredits, c...)
-
-		// Update user database.
-		err = b.db.UserUpdate(*user)
-		if err != nil {
+		paywall.GrantProposalCredits(user, p, *payment, time.Now().Unix())
+
+		// Update user database.  The payment tx is used as the operation
+		// ID so that credits are never granted twice for the same payment.
+		err = b.db.UserUpdateOnce(paywall.CreditsOperationID(p.TxID), *user)
+		if err == database.ErrDuplicateOperation {
+			log.Debugf("proposal credits for tx %v already granted",
+				p.TxID)
+			return nil
+		} else if err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,131 @@
+// Copyright (c) 2017 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package paywall confirms payments to the registration and proposal credit
+// paywalls of users.  Payments are looked up through a PaymentProcessor so
+// that other settlement backends can be used without changing how payments
+// are recorded in the user database.
+package paywall
+
+import (
+	"github.com/decred/politeia/politeiawww/database"
+	"github.com/decred/politeia/util"
+)
+
+// ErrCannotVerifyPayment is returned by a PaymentProcessor when it can't
+// reach the backend that it looks payments up with.
+var ErrCannotVerifyPayment = util.ErrCannotVerifyPayment
+
+// Paywall is an address that a payment is expected to.
+type Paywall struct {
+	Address     string // Paywall address
+	Amount      uint64 // Minimum amount in atoms
+	TxNotBefore int64  // Minimum timestamp of the payment
+}
+
+// Payment is a payment that satisfies a paywall.
+type Payment struct {
+	TxID   string // Transaction id
+	Amount uint64 // Amount paid to the paywall address in atoms
+}
+
+// PaymentProcessor looks up payments to paywalls.
+type PaymentProcessor interface {
+	// FetchPayment returns a payment to the paywall address of at least
+	// the paywall amount that was made after TxNotBefore and has at least
+	// minConfirmations confirmations.  It returns nil if there is no such
+	// payment yet.
+	FetchPayment(p Paywall, minConfirmations uint64) (*Payment, error)
+}
+
+// Dcrdata looks up payments with the dcrdata API.  It is the default
+// PaymentProcessor.
+type Dcrdata struct {
+	// APIURL is the dcrdata API, e.g. https://explorer.dcrdata.org/api.
+	// If empty, the public dcrdata of the network of the paywall address is
+	// used, with insight as a fallback.
+	APIURL string
+}
+
+// FetchPayment satisfies the PaymentProcessor interface.
+func (d *Dcrdata) FetchPayment(p Paywall, minConfirmations uint64) (*Payment, error) {
+	var (
+		txID   string
+		amount uint64
+		err    error
+	)
+	if d.APIURL == "" {
+		txID, amount, err = util.FetchTxWithBlockExplorers(p.Address,
+			p.Amount, p.TxNotBefore, minConfirmations)
+	} else {
+		txID, amount, err = util.FetchTxWithDcrdata(d.APIURL, p.Address,
+			p.Amount, p.TxNotBefore, minConfirmations)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if txID == "" {
+		return nil, nil
+	}
+
+	return &Payment{
+		TxID:   txID,
+		Amount: amount,
+	}, nil
+}
+
+// UserPaywall returns the registration paywall of the user.
+func UserPaywall(u *database.User) Paywall {
+	return Paywall{
+		Address:     u.NewUserPaywallAddress,
+		Amount:      u.NewUserPaywallAmount,
+		TxNotBefore: u.NewUserPaywallTxNotBefore,
+	}
+}
+
+// ProposalPaywall returns the paywall of a proposal credit paywall.  Any
+// payment of at least the price of one credit satisfies it.
+func ProposalPaywall(p *database.ProposalPaywall) Paywall {
+	return Paywall{
+		Address:     p.Address,
+		Amount:      p.CreditPrice,
+		TxNotBefore: p.TxNotBefore,
+	}
+}
+
+// MarkUserPaid marks the registration paywall of the user as paid by the
+// transaction at the given time and stops polling it.  The caller must store
+// the user.
+func MarkUserPaid(u *database.User, txID string, timestamp int64) {
+	u.NewUserPaywallTx = txID
+	u.NewUserPaywallTxTime = timestamp
+	u.NewUserPaywallPollExpiry = 0
+}
+
+// CreditsOperationID returns the operation ID under which the proposal
+// credits of a payment are stored with UserUpdateOnce, so that credits are
+// never granted twice for the same payment.
+func CreditsOperationID(txID string) string {
+	return "proposalcredits:" + txID
+}
+
+// GrantProposalCredits records the payment on the proposal paywall, which
+// must belong to the user, and adds a proposal credit to the user for every
+// credit price paid.  The caller must store the user with UserUpdateOnce and
+// CreditsOperationID.
+func GrantProposalCredits(u *database.User, p *database.ProposalPaywall, payment Payment, timestamp int64) {
+	p.TxID = payment.TxID
+	p.TxAmount = payment.Amount
+	p.NumCredits = payment.Amount / p.CreditPrice
+
+	for i := uint64(0); i < p.NumCredits; i++ {
+		u.UnspentProposalCredits = append(u.UnspentProposalCredits,
+			database.ProposalCredit{
+				PaywallID:     p.ID,
+				Price:         p.CreditPrice,
+				DatePurchased: timestamp,
+				TxID:          p.TxID,
+			})
+	}
+}
@@ -0,0 +1,69 @@
+package paywall
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/decred/politeia/politeiawww/database"
+)
+
+func TestDcrdata(t *testing.T) {
+	const address = "TsfDLrRkk9ciUuwfp2b8PawwnukYD7yAjGd"
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/address/"+address+"/raw" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[
+			{"txid":"old","time":100,"confirmations":10,"vout":[{"value":"1","scriptPubkey":{"addresses":["` + address + `"]}}]},
+			{"txid":"small","time":300,"confirmations":10,"vout":[{"value":"0.05","scriptPubkey":{"addresses":["` + address + `"]}}]},
+			{"txid":"paid","time":300,"confirmations":2,"vout":[{"value":"0.25","scriptPubkey":{"addresses":["` + address + `"]}}]}
+		]`))
+	}))
+	defer s.Close()
+
+	var pp PaymentProcessor = &Dcrdata{APIURL: s.URL + "/api/"}
+	p := Paywall{
+		Address:     address,
+		Amount:      1e7,
+		TxNotBefore: 200,
+	}
+	payment, err := pp.FetchPayment(p, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment == nil || payment.TxID != "paid" || payment.Amount != 25e6 {
+		t.Fatalf("unexpected payment %+v", payment)
+	}
+
+	// Not enough confirmations yet.
+	payment, err = pp.FetchPayment(p, 3)
+	if err != nil || payment != nil {
+		t.Fatalf("unexpected payment %+v: %v", payment, err)
+	}
+}
+
+func TestGrantProposalCredits(t *testing.T) {
+	u := database.User{
+		ProposalPaywalls: []database.ProposalPaywall{{
+			ID:          1,
+			CreditPrice: 1e7,
+		}},
+	}
+	p := &u.ProposalPaywalls[0]
+	GrantProposalCredits(&u, p, Payment{TxID: "tx", Amount: 25e6}, 1530000000)
+
+	if p.TxID != "tx" || p.TxAmount != 25e6 || p.NumCredits != 2 {
+		t.Fatalf("paywall not updated: %+v", p)
+	}
+	if len(u.UnspentProposalCredits) != 2 {
+		t.Fatalf("got %v credits, expected 2", len(u.UnspentProposalCredits))
+	}
+	for _, c := range u.UnspentProposalCredits {
+		if c.PaywallID != 1 || c.Price != 1e7 || c.TxID != "tx" ||
+			c.DatePurchased != 1530000000 {
+			t.Fatalf("unexpected credit %+v", c)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2017 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package sessions provides a gorilla/sessions compatible session store that
+// persists sessions in the politeiawww database.  Sessions stored this way
+// survive server restarts and can be revoked for a user in bulk.
+package sessions
+
+import (
+	"encoding/base32"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/decred/politeia/politeiawww/database"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// UserIDKey is the session value key that holds the uint64 ID of the user
+// that owns the session.  It is used to revoke all sessions of a user.
+const UserIDKey = "userid"
+
+var (
+	_ sessions.Store = (*DatabaseStore)(nil)
+)
+
+// DatabaseStore stores sessions in the politeiawww database.  Only the
+// session ID is stored in the cookie.
+type DatabaseStore struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options // Default configuration
+
+	db database.Database
+}
+
+// Get returns a session for the given name after adding it to the registry.
+//
+// Get satisfies the sessions.Store interface.
+func (s *DatabaseStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the
+// registry.  If the request contains a valid session cookie the session is
+// loaded from the database.
+//
+// New satisfies the sessions.Store interface.
+func (s *DatabaseStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, errCookie := r.Cookie(name)
+	if errCookie != nil {
+		return session, nil
+	}
+
+	err := securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...)
+	if err != nil {
+		return session, err
+	}
+
+	err = s.load(session)
+	if err == database.ErrSessionNotFound {
+		// The session expired or was revoked; start over.
+		return session, nil
+	} else if err != nil {
+		return session, err
+	}
+	session.IsNew = false
+
+	return session, nil
+}
+
+// Save writes the session to the database and sets the session cookie.  A
+// session with a MaxAge <= 0 is deleted from the database.
+//
+// Save satisfies the sessions.Store interface.
+func (s *DatabaseStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge <= 0 {
+		if session.ID != "" {
+			err := s.db.SessionDeleteByID(session.ID)
+			if err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, newCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(
+			securecookie.GenerateRandomKey(32)), "=")
+	}
+
+	err := s.save(session)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID,
+		s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, newCookie(session.Name(), encoded, session.Options))
+
+	return nil
+}
+
+// RevokeUser deletes all sessions that belong to the given user.
+func (s *DatabaseStore) RevokeUser(userID uint64) error {
+	return s.db.SessionsDeleteByUserID(userID)
+}
+
+// save encodes the session values and writes the session to the database.
+func (s *DatabaseStore) save(session *sessions.Session) error {
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values,
+		s.Codecs...)
+	if err != nil {
+		return err
+	}
+
+	// Preserve the creation time of existing sessions.
+	now := time.Now()
+	createdAt := now.Unix()
+	ds, err := s.db.SessionGetByID(session.ID)
+	if err == nil {
+		createdAt = ds.CreatedAt
+	} else if err != database.ErrSessionNotFound {
+		return err
+	}
+
+	userID, _ := session.Values[UserIDKey].(uint64)
+	return s.db.SessionSave(database.Session{
+		ID:        session.ID,
+		UserID:    userID,
+		Values:    encoded,
+		CreatedAt: createdAt,
+		Expiry: now.Add(time.Duration(session.Options.MaxAge) *
+			time.Second).Unix(),
+	})
+}
+
+// load reads the session from the database and decodes its values.
+func (s *DatabaseStore) load(session *sessions.Session) error {
+	ds, err := s.db.SessionGetByID(session.ID)
+	if err != nil {
+		return err
+	}
+
+	return securecookie.DecodeMulti(session.Name(), ds.Values,
+		&session.Values, s.Codecs...)
+}
+
+// newCookie returns an http.Cookie with the options set.
+func newCookie(name, value string, options *sessions.Options) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     options.Path,
+		Domain:   options.Domain,
+		MaxAge:   options.MaxAge,
+		Secure:   options.Secure,
+		HttpOnly: options.HttpOnly,
+	}
+	if options.MaxAge > 0 {
+		cookie.Expires = time.Now().Add(time.Duration(options.MaxAge) *
+			time.Second)
+	} else if options.MaxAge < 0 {
+		cookie.Expires = time.Unix(1, 0)
+	}
+
+	return cookie
+}
+
+// NewDatabaseStore returns a new DatabaseStore.  The key pairs are used to
+// authenticate and optionally encrypt the session ID cookie and the stored
+// session values; see securecookie.CodecsFromPairs.
+func NewDatabaseStore(db database.Database, keyPairs ...[]byte) *DatabaseStore {
+	return &DatabaseStore{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: 86400 * 30,
+		},
+		db: db,
+	}
+}
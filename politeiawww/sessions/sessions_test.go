@@ -0,0 +1,73 @@
+package sessions
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/decred/politeia/politeiawww/database/localdb"
+)
+
+func TestDatabaseStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessions.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := localdb.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store := NewDatabaseStore(db, []byte("0123456789abcdef0123456789abcdef"))
+
+	// Create and save a new session.
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	session, err := store.New(r, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !session.IsNew {
+		t.Fatalf("expected new session")
+	}
+	session.Values["email"] = "user@example.com"
+	session.Values[UserIDKey] = uint64(7)
+	w := httptest.NewRecorder()
+	if err := store.Save(r, w, session); err != nil {
+		t.Fatal(err)
+	}
+
+	// Load the session using the cookie that was set.
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected 1 cookie, got %v", len(cookies))
+	}
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookies[0])
+	loaded, err := store.New(r, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.IsNew || loaded.ID != session.ID {
+		t.Fatalf("session was not loaded")
+	}
+	if loaded.Values["email"] != "user@example.com" {
+		t.Fatalf("unexpected session values %v", loaded.Values)
+	}
+
+	// Revoke all sessions of the user.
+	if err := store.RevokeUser(7); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = store.New(r, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.IsNew {
+		t.Fatalf("expected revoked session to be new")
+	}
+}
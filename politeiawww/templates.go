@@ -35,3 +35,18 @@ const templateUserLockedResetPasswordRaw = `
 <div style="margin-top: 20px">You are receiving this email because someone made too many login attempts for <span style="font-weight: bold">{{.Email}}</span> on Politeia.</div>
 <div>If that was not you, please notify Politeia administrators.</div>
 `
+
+const templateAdminDigestEmailRaw = `
+<div>Politeia activity from {{.Since.Format "2006-01-02 15:04 MST"}} to {{.Until.Format "2006-01-02 15:04 MST"}}:</div>
+<ul>
+<li>New users: {{len .NewUsers}}{{range $i, $u := .NewUsers}}{{if $i}},{{else}} -{{end}} {{$u}}{{end}}</li>
+<li>Users that have not paid the registration fee: {{.UnpaidUsers}}</li>
+<li>Registration fees paid: {{.UserPayments}}</li>
+<li>Proposal credits purchased: {{.CreditsPurchased}} ({{.CreditPayments}} payments)</li>
+<li>Proposals pending review: {{.ProposalsUnvetted}}</li>
+<li>Public proposals: {{.ProposalsPublic}}</li>
+<li>Censored proposals: {{.ProposalsCensored}}</li>
+<li>Audit log entries: {{.AuditEntries}}{{range $i, $a := .AuditActions}}{{if $i}},{{else}} -{{end}} {{$a.Action}} ({{$a.Count}}){{end}}</li>
+</ul>
+<div style="margin-top: 20px">You are receiving this email because you are a Politeia administrator.</div>
+`
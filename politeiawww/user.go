@@ -27,7 +27,7 @@ func convertWWWUserFromDatabaseUser(user *database.User) v1.User {
 		ResetPasswordVerificationExpiry: user.ResetPasswordVerificationExpiry,
 		LastLoginTime:                   user.LastLoginTime,
 		FailedLoginAttempts:             user.FailedLoginAttempts,
-		Locked:                          checkUserIsLocked(user.FailedLoginAttempts),
+		Locked:                          checkUserIsLocked(user),
 		Identities:                      convertWWWIdentitiesFromDatabaseIdentities(user.Identities),
 		ProposalCredits:                 ProposalCreditBalance(user),
 	}
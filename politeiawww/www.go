@@ -22,6 +22,8 @@ import (
 
 	"github.com/decred/politeia/politeiawww/api/v1"
 	"github.com/decred/politeia/politeiawww/database"
+	"github.com/decred/politeia/politeiawww/database/localdb"
+	dbsessions "github.com/decred/politeia/politeiawww/sessions"
 	"github.com/decred/politeia/util"
 	"github.com/gorilla/csrf"
 	"github.com/gorilla/mux"
@@ -43,7 +45,7 @@ type politeiawww struct {
 	cfg    *config
 	router *mux.Router
 
-	store *sessions.FilesystemStore
+	store *dbsessions.DatabaseStore
 
 	backend *backend
 }
@@ -95,8 +97,9 @@ func (p *politeiawww) getSessionUser(r *http.Request) (*database.User, error) {
 	return p.backend.db.UserGet(email)
 }
 
-// setSessionUser sets the "email" session key to the provided value.
-func (p *politeiawww) setSessionUser(w http.ResponseWriter, r *http.Request, email string) error {
+// setSessionUser sets the "email" and user ID session keys to the provided
+// values.
+func (p *politeiawww) setSessionUser(w http.ResponseWriter, r *http.Request, email string, userID uint64) error {
 	log.Tracef("setSessionUser: %v %v", email, v1.CookieSession)
 	session, err := p.getSession(r)
 	if err != nil {
@@ -104,10 +107,11 @@ func (p *politeiawww) setSessionUser(w http.ResponseWriter, r *http.Request, ema
 	}
 
 	session.Values["email"] = email
+	session.Values[dbsessions.UserIDKey] = userID
 	return session.Save(r, w)
 }
 
-// removeSession deletes the session from the filesystem.
+// removeSession deletes the session from the database.
 func (p *politeiawww) removeSession(w http.ResponseWriter, r *http.Request) error {
 	log.Tracef("removeSession: %v", v1.CookieSession)
 	session, err := p.getSession(r)
@@ -121,7 +125,7 @@ func (p *politeiawww) removeSession(w http.ResponseWriter, r *http.Request) erro
 	}
 
 	// Saving the session with a negative MaxAge will cause it to be deleted
-	// from the filesystem.
+	// from the database.
 	session.Options.MaxAge = -1
 	return session.Save(r, w)
 }
@@ -452,7 +456,13 @@ func (p *politeiawww) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Mark user as logged in if there's no error.
-	err = p.setSessionUser(w, r, l.Email)
+	userID, err := strconv.ParseUint(reply.UserID, 10, 64)
+	if err != nil {
+		RespondWithError(w, r, 0,
+			"handleLogin: ParseUint %v", err)
+		return
+	}
+	err = p.setSessionUser(w, r, l.Email, userID)
 	if err != nil {
 		RespondWithError(w, r, 0,
 			"handleLogin: setSessionUser %v", err)
@@ -1274,6 +1284,10 @@ func _main() error {
 		}
 	}()
 
+	// Package loggers write to the log rotator, so they are only set up
+	// here and not in NewBackend, which is also used by the tests.
+	localdb.UseLogger(localdbLog)
+
 	log.Infof("Version : %v", version())
 	log.Infof("Network : %v", activeNetParams.Params.Name)
 	log.Infof("Home dir: %v", loadedCfg.HomeDir)
@@ -1483,12 +1497,7 @@ func _main() error {
 		}
 		log.Infof("Cookie key generated.")
 	}
-	sessionsDir := filepath.Join(p.cfg.DataDir, "sessions")
-	err = os.MkdirAll(sessionsDir, 0700)
-	if err != nil {
-		return err
-	}
-	p.store = sessions.NewFilesystemStore(sessionsDir, cookieKey)
+	p.store = dbsessions.NewDatabaseStore(p.backend.db, cookieKey)
 	p.store.Options = &sessions.Options{
 		Path:     "/",
 		MaxAge:   86400, // One day
@@ -1548,6 +1557,8 @@ func _main() error {
 	}
 done:
 
+	p.backend.stopAdminDigest()
+
 	log.Infof("Exiting")
 
 	return nil
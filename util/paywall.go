@@ -296,6 +296,16 @@ func PayWithTestnetFaucet(faucetURL string, address string, amount uint64, overr
 	return fr.Txid, nil
 }
 
+// FetchTxWithDcrdata uses the dcrdata API at the given URL, e.g.
+// https://explorer.dcrdata.org/api, to look for a transaction for the given
+// address that equals or exceeds the given amount, occurs after the
+// txnotbefore time and has the minimum number of confirmations.
+func FetchTxWithDcrdata(apiURL string, address string, amount uint64, txnotbefore int64, minConfirmations uint64) (string, uint64, error) {
+	url := strings.TrimRight(apiURL, "/") + "/address/" + address + "/raw"
+	return fetchTxWithPrimaryBE(url, address, amount, txnotbefore,
+		minConfirmations)
+}
+
 // FetchTxWithBlockExplorers uses public block explorers to look for a
 // transaction for the given address that equals or exceeds the given amount,
 // occurs after the txnotbefore time and has the minimum number of confirmations.